@@ -1,72 +1,301 @@
 package container
 
 import (
+	"bytes"
+	"errors"
+	"io/ioutil"
 	"os"
-	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
 
 	"github.com/subutai-io/agent/config"
 	"github.com/subutai-io/agent/log"
+
+	lxc "github.com/subutai-io/agent/lib/container"
 )
 
-var (
-	contsStatus map[string]int
+// State is a point in a container's Stopped -> Starting -> Running ->
+// Stopping lifecycle, driven by .start/.stop marker file events rather
+// than polled on a timer.
+type State int
+
+const (
+	Stopped State = iota
+	Starting
+	Running
+	Stopping
 )
 
-func init() {
-	contsStatus = make(map[string]int)
+func (s State) String() string {
+	switch s {
+	case Starting:
+		return "Starting"
+	case Running:
+		return "Running"
+	case Stopping:
+		return "Stopping"
+	default:
+		return "Stopped"
+	}
+}
+
+// Status is a single state transition, published on the channel
+// StateRestore returns for the monitoring package to subscribe to. The
+// channel is best-effort and bounded: if nothing drains it fast enough,
+// containerFSM.set drops the oldest queued Status rather than blocking,
+// so a slow or absent consumer can lose transitions but never wedges the
+// FSM goroutine that's reporting them.
+type Status struct {
+	Container string
+	State     State
+	Err       error
 }
 
-// StateRestore checks container state and starting or stopping containers if required.
-func StateRestore() {
-	for _, cont := range Active(false) {
-		var start, stop bool
-
-		switch contsStatus[cont.Name] {
-		case 100:
-		case 5:
-			{
-				log.Debug("Failed to START container " + cont.Name + " after 5 attempts")
-				contsStatus[cont.Name] = 100
-			}
-		case -5:
-			{
-				log.Debug("Failed to STOP container " + cont.Name + " after 5 attempts")
-				contsStatus[cont.Name] = 100
-			}
-		case 10:
-			{
-				log.Debug(".start and .stop files exist on " + cont.Name + " cont ")
-				contsStatus[cont.Name] = 100
-			}
+const (
+	minBackoff  = 500 * time.Millisecond
+	maxBackoff  = 30 * time.Second
+	maxAttempts = 5
+)
+
+// marker is which of a container's desired-state files fired an inotify
+// create event.
+type marker int
+
+const (
+	markerStart marker = iota
+	markerStop
+)
+
+// StateRestore replaces the old polling loop: a single inotify watch on
+// config.Agent.LxcPrefix picks up new container directories, a watch per
+// container picks up .start/.stop marker creates, and each container gets
+// its own goroutine running the state machine with exponential backoff
+// between retries, calling lxc.Start/lxc.Stop in-process instead of
+// re-forking `subutai start`/`subutai stop`. It returns immediately; the
+// watch loop runs in the background for the lifetime of the process.
+//
+// Calling lxc.Start/lxc.Stop in-process means a container lookup failure
+// there (log.FatalLevel) takes the whole daemon down exactly as it always
+// has for every other lib/container caller, not just a forked subprocess —
+// an accepted trade-off of moving this in-process.
+func StateRestore() (<-chan Status, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	topWd, err := unix.InotifyAddWatch(fd, config.Agent.LxcPrefix, unix.IN_CREATE)
+	if err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	w := &watcher{
+		fd:     fd,
+		topWd:  topWd,
+		byWd:   map[int]string{},
+		fsms:   map[string]*containerFSM{},
+		status: make(chan Status, 64),
+	}
+
+	entries, err := ioutil.ReadDir(config.Agent.LxcPrefix)
+	log.Check(log.WarnLevel, "Listing "+config.Agent.LxcPrefix, err)
+	for _, e := range entries {
+		if e.IsDir() {
+			w.watchContainer(e.Name())
+		}
+	}
+
+	go w.loop()
+	return w.status, nil
+}
+
+// watcher owns the inotify fd and routes events to each container's FSM.
+type watcher struct {
+	fd     int
+	topWd  int
+	mu     sync.Mutex
+	byWd   map[int]string
+	fsms   map[string]*containerFSM
+	status chan Status
+}
+
+// watchContainer adds an inotify watch for name's directory, starts its
+// FSM goroutine, and replays any .start/.stop marker already on disk —
+// inotify only reports creates from this point forward, so a marker
+// written before the watch existed would otherwise be missed.
+func (w *watcher) watchContainer(name string) {
+	path := config.Agent.LxcPrefix + name
+	wd, err := unix.InotifyAddWatch(w.fd, path, unix.IN_CREATE)
+	if log.Check(log.WarnLevel, "Watching "+path, err) {
+		return
+	}
+
+	// Start from the container's actual state, so a .stop marker for a
+	// container that is already running is acted on rather than ignored.
+	state := Stopped
+	if lxc.State(name) == "RUNNING" {
+		state = Running
+	}
+	f := &containerFSM{name: name, state: state, events: make(chan marker, 8), status: w.status}
+
+	w.mu.Lock()
+	w.byWd[wd] = name
+	w.fsms[name] = f
+	w.mu.Unlock()
+
+	go f.run()
+
+	if _, err := os.Stat(path + "/.start"); err == nil {
+		f.events <- markerStart
+	}
+	if _, err := os.Stat(path + "/.stop"); err == nil {
+		f.events <- markerStop
+	}
+}
+
+// loop reads raw inotify events off fd until it's closed and dispatches
+// them to the top-level watch (a new container directory) or to a
+// container's FSM (a .start/.stop marker).
+func (w *watcher) loop() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := unix.Read(w.fd, buf)
+		if err != nil {
+			log.Error("Reading inotify events: " + err.Error())
+			return
+		}
+
+		offset := 0
+		for offset+unix.SizeofInotifyEvent <= n {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			nameEnd := nameStart + int(raw.Len)
+			name := string(bytes.TrimRight(buf[nameStart:nameEnd], "\x00"))
+			w.dispatch(int(raw.Wd), name)
+			offset = nameEnd
+		}
+	}
+}
+
+func (w *watcher) dispatch(wd int, name string) {
+	if wd == w.topWd {
+		if info, err := os.Stat(config.Agent.LxcPrefix + name); err == nil && info.IsDir() {
+			w.watchContainer(name)
+		}
+		return
+	}
+
+	w.mu.Lock()
+	container, ok := w.byWd[wd]
+	w.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	switch name {
+	case ".start":
+		w.send(container, markerStart)
+	case ".stop":
+		w.send(container, markerStop)
+	}
+}
+
+func (w *watcher) send(container string, m marker) {
+	w.mu.Lock()
+	f := w.fsms[container]
+	w.mu.Unlock()
+	if f != nil {
+		f.events <- m
+	}
+}
+
+// containerFSM drives a single container through Stopped -> Starting ->
+// Running (or -> Stopping -> Stopped), retrying lxc.Start/lxc.Stop with
+// exponential backoff. Its state is only ever touched by run, so unlike
+// the old global contsStatus map it needs no mutex.
+type containerFSM struct {
+	name   string
+	state  State
+	events chan marker
+	status chan<- Status
+}
+
+func (f *containerFSM) run() {
+	for ev := range f.events {
+		switch ev {
+		case markerStart:
+			f.toRunning()
+		case markerStop:
+			f.toStopped()
+		}
+	}
+}
+
+func (f *containerFSM) toRunning() {
+	if f.state == Running || f.state == Starting {
+		return
+	}
+	f.set(Starting, nil)
+
+	backoff := minBackoff
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		lxc.Start(f.name)
+		if lxc.State(f.name) == "RUNNING" {
+			f.set(Running, nil)
+			return
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	f.set(Stopped, errors.New("failed to start "+f.name+" after "+strconv.Itoa(maxAttempts)+" attempts"))
+}
+
+func (f *containerFSM) toStopped() {
+	if f.state == Stopped || f.state == Stopping {
+		return
+	}
+	f.set(Stopping, nil)
+
+	backoff := minBackoff
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		lxc.Stop(f.name)
+		if lxc.State(f.name) == "STOPPED" {
+			f.set(Stopped, nil)
+			return
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+	f.set(Stopped, errors.New("failed to stop "+f.name+" after "+strconv.Itoa(maxAttempts)+" attempts"))
+}
+
+// set updates the FSM's state and publishes the transition on status. The
+// publish is non-blocking: if the channel's buffer is full (no one has
+// drained it), the oldest queued Status is dropped to make room rather
+// than blocking this goroutine forever, which would otherwise stop this
+// container's .start/.stop markers from ever being processed again.
+func (f *containerFSM) set(s State, err error) {
+	f.state = s
+	status := Status{Container: f.name, State: s, Err: err}
+	select {
+	case f.status <- status:
+	default:
+		select {
+		case <-f.status:
+		default:
+		}
+		select {
+		case f.status <- status:
 		default:
-			{
-				if _, err := os.Stat(config.Agent.LxcPrefix + cont.Name + "/.start"); err == nil {
-					start = true
-				}
-				if _, err := os.Stat(config.Agent.LxcPrefix + cont.Name + "/.stop"); err == nil {
-					stop = true
-				}
-				if start && stop {
-					contsStatus[cont.Name] = 10
-					break
-				}
-				switch {
-				case start && cont.Status != "RUNNING":
-					{
-						err := exec.Command("subutai", "start", cont.Name).Run()
-						log.Check(log.DebugLevel, "Trying to start "+cont.Name, err)
-						contsStatus[cont.Name]++
-					}
-				case stop && cont.Status != "STOPPED":
-					{
-						err := exec.Command("subutai", "stop", cont.Name).Run()
-						log.Check(log.DebugLevel, "Trying to stop "+cont.Name, err)
-						contsStatus[cont.Name]--
-					}
-				default:
-					contsStatus[cont.Name] = 0
-				}
-			}
 		}
 	}
 }
@@ -0,0 +1,61 @@
+// Package caps declares, per RPC method, the Linux capabilities and
+// filesystem paths an operation actually needs. subutaid uses this table to
+// decide whether an unprivileged caller may invoke a method directly and
+// `subutai caps` uses it to print the requirement for auditing.
+package caps
+
+// Requirement describes what a method needs to run.
+type Requirement struct {
+	// Caps are Linux capability names, e.g. "CAP_SYS_ADMIN". Empty means
+	// the operation is safe for any local user (a read-only query).
+	Caps []string
+	// Paths are filesystem locations the caller needs write access to.
+	Paths []string
+}
+
+// ByMethod is the capability table for every RPC method subutaid exposes.
+// Methods absent from this table are treated as requiring full root,
+// matching the pre-capability-model legacy behavior.
+var ByMethod = map[string]Requirement{
+	"LxcAttach":          {Caps: []string{"CAP_SYS_ADMIN"}, Paths: []string{"/var/lib/lxc"}},
+	"LxcClone":           {Caps: []string{"CAP_SYS_ADMIN"}, Paths: []string{"/var/lib/lxc"}},
+	"LxcDestroy":         {Caps: []string{"CAP_SYS_ADMIN"}, Paths: []string{"/var/lib/lxc"}},
+	"LxcStart":           {Caps: []string{"CAP_SYS_ADMIN"}, Paths: []string{"/var/lib/lxc"}},
+	"LxcStop":            {Caps: []string{"CAP_SYS_ADMIN"}, Paths: []string{"/var/lib/lxc"}},
+	"LxcQuota":           {Caps: []string{"CAP_SYS_ADMIN", "CAP_SYS_RESOURCE"}, Paths: []string{"/var/lib/lxc"}},
+	"LxcRename":          {Caps: []string{"CAP_SYS_ADMIN"}, Paths: []string{"/var/lib/lxc"}},
+	"MapPort":            {Caps: []string{"CAP_NET_ADMIN"}, Paths: []string{"/etc/nginx"}},
+	"MetricsServe":       {Caps: nil, Paths: nil},
+	"LxcList":            {Caps: nil, Paths: nil},
+	"Info":               {Caps: nil, Paths: nil},
+	"Log":                {Caps: nil, Paths: nil},
+	"HostMetrics":        {Caps: nil, Paths: nil},
+	"Export":             {Caps: []string{"CAP_SYS_ADMIN"}, Paths: []string{"/var/lib/lxc"}},
+	"Import":             {Caps: []string{"CAP_SYS_ADMIN"}, Paths: []string{"/var/lib/lxc"}},
+	"Backup":             {Caps: []string{"CAP_SYS_ADMIN"}, Paths: []string{"/var/lib/lxc"}},
+	"Cleanup":            {Caps: []string{"CAP_SYS_ADMIN"}, Paths: []string{"/var/lib/lxc"}},
+	"Demote":             {Caps: []string{"CAP_SYS_ADMIN"}, Paths: []string{"/var/lib/lxc"}},
+	"SetContainerConfig": {Caps: []string{"CAP_SYS_ADMIN"}, Paths: []string{"/var/lib/lxc"}},
+	"ProxyAdd":           {Caps: []string{"CAP_NET_ADMIN"}, Paths: []string{"/etc/nginx"}},
+	"ProxyDel":           {Caps: []string{"CAP_NET_ADMIN"}, Paths: []string{"/etc/nginx"}},
+	"ProxyCheck":         {Caps: nil, Paths: nil},
+	"VxlanTunnel":        {Caps: []string{"CAP_NET_ADMIN"}, Paths: nil},
+	"P2P":                {Caps: []string{"CAP_NET_ADMIN"}, Paths: nil},
+	"TunAdd":             {Caps: []string{"CAP_NET_ADMIN"}, Paths: nil},
+	"TunDel":             {Caps: []string{"CAP_NET_ADMIN"}, Paths: nil},
+	"TunList":            {Caps: nil, Paths: nil},
+	"TunCheck":           {Caps: nil, Paths: nil},
+	"IngressLogin":       {Caps: []string{"CAP_NET_ADMIN"}, Paths: []string{"/var/lib/subutai"}},
+	"IngressList":        {Caps: nil, Paths: nil},
+	"IngressRouteAdd":    {Caps: []string{"CAP_NET_ADMIN"}, Paths: []string{"/var/lib/subutai", "/etc/nginx"}},
+}
+
+// RequiresRoot reports whether method needs root: true for every method
+// that declares at least one capability and for every method absent from
+// ByMethod. Only methods with no capabilities count as safe for an
+// unprivileged caller; no capability is granted to a non-root caller
+// through file capabilities.
+func RequiresRoot(method string) bool {
+	req, ok := ByMethod[method]
+	return !ok || len(req.Caps) > 0
+}
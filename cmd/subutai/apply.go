@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/subutai-io/agent/pipeline"
+
+	gcli "github.com/urfave/cli/v2"
+)
+
+// applyCommand implements `subutai apply -f pipeline.yaml`: it reconciles
+// the RH toward the declarative state described by the manifest, running
+// independent steps in parallel and rolling back on failure.
+var applyCommand = &gcli.Command{
+	Name:     "apply",
+	Usage:    "reconcile the host toward a declarative pipeline manifest",
+	Category: "Host",
+	Flags: []gcli.Flag{
+		&gcli.StringFlag{Name: "file", Aliases: []string{"f"}, Usage: "path to pipeline.yaml"},
+		&gcli.BoolFlag{Name: "dry-run", Usage: "print what would be applied without changing anything"},
+		&gcli.BoolFlag{Name: "diff", Usage: "accepted but has no effect: no diff against the host's current state is computed"},
+		&gcli.BoolFlag{Name: "keep-on-failure", Usage: "do not roll back already-applied steps on failure"},
+	},
+	Action: func(c *gcli.Context) error {
+		if c.String("f") == "" {
+			return errors.New("-f pipeline.yaml is required")
+		}
+		manifest, err := pipeline.Load(c.String("f"))
+		if err != nil {
+			return err
+		}
+
+		return pipeline.Run(manifest, stepExecutor, pipeline.Options{
+			DryRun:        c.Bool("dry-run"),
+			KeepOnFailure: c.Bool("keep-on-failure"),
+			Rollback:      stepRollback,
+		})
+	},
+}
+
+// stepMethods maps a manifest step kind to the RPC method and rollback
+// method that implement it. Where the rollback method is the apply method
+// itself, stepRollback passes it the "r" (remove) flag.
+var stepMethods = map[string]struct{ apply, rollback string }{
+	"clone": {"LxcClone", "LxcDestroy"},
+	"quota": {"LxcQuota", ""},
+	"map":   {"MapPort", "MapPort"},
+	"proxy": {"ProxyAdd", "ProxyDel"},
+	"vxlan": {"VxlanTunnel", "VxlanTunnel"},
+	"p2p":   {"P2P", "P2P"},
+}
+
+func stepExecutor(step pipeline.Step) error {
+	methods, ok := stepMethods[step.Kind]
+	if !ok {
+		return errors.New("unknown pipeline step kind: " + step.Kind)
+	}
+	return call(methods.apply, []string{step.Params["name"]}, step.Params)
+}
+
+func stepRollback(step pipeline.Step) error {
+	methods, ok := stepMethods[step.Kind]
+	if !ok || methods.rollback == "" {
+		return nil
+	}
+	flags := step.Params
+	if methods.rollback == methods.apply {
+		flags = map[string]string{}
+		for k, v := range step.Params {
+			flags[k] = v
+		}
+		flags["r"] = "true"
+	}
+	return call(methods.rollback, []string{step.Params["name"]}, flags)
+}
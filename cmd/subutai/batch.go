@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// runBatch replays a file of RPC calls, one per line, in order: each line
+// is "<Method> <arg0> <arg1> ... [flag=value ...]", e.g.
+// "LxcClone web-app 10.10.1.2 e=prod". It stops at the first failing
+// line rather than continuing past it, the same fail-fast behavior as
+// every other multi-step entry point (pipeline.Run, Info's traversal).
+func runBatch(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		method := fields[0]
+		var args []string
+		flags := make(map[string]string)
+		for _, field := range fields[1:] {
+			if kv := strings.SplitN(field, "=", 2); len(kv) == 2 {
+				flags[kv[0]] = kv[1]
+			} else {
+				args = append(args, field)
+			}
+		}
+
+		if err := call(method, args, flags); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
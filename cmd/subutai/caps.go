@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/subutai-io/agent/caps"
+
+	gcli "github.com/urfave/cli/v2"
+)
+
+// capsCommand prints the Linux capabilities and filesystem paths each RPC
+// method requires, for auditing which subcommands a given deployment can
+// safely expose to unprivileged users.
+var capsCommand = &gcli.Command{
+	Name:     "caps",
+	Usage:    "print required capabilities per subcommand",
+	Category: "Host",
+	Action: func(c *gcli.Context) error {
+		methods := make([]string, 0, len(caps.ByMethod))
+		for m := range caps.ByMethod {
+			methods = append(methods, m)
+		}
+		sort.Strings(methods)
+
+		for _, m := range methods {
+			req := caps.ByMethod[m]
+			capList := "none"
+			if len(req.Caps) > 0 {
+				capList = strings.Join(req.Caps, ",")
+			}
+			fmt.Printf("%-14s caps=%-30s paths=%s\n", m, capList, strings.Join(req.Paths, ","))
+		}
+		return nil
+	},
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/subutai-io/agent/cli"
+	"github.com/subutai-io/agent/ingress"
+)
+
+// callLegacy runs method in-process against the `cli` package, bypassing
+// subutaid entirely, printing any output the same way call()'s RPC path
+// does. It only covers the handful of methods exercised through
+// --legacy-root; anything else falls back to an explicit error rather than
+// silently degrading.
+func callLegacy(method string, args []string, flags map[string]string) error {
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	print := func(out string, err error) error {
+		if len(out) > 0 {
+			fmt.Println(out)
+		}
+		return err
+	}
+
+	ctx := context.Background()
+	switch method {
+	case "LxcClone":
+		return cli.LxcClone(ctx, arg(0), arg(1), flags["e"], flags["i"], flags["t"], flags["k"])
+	case "LxcDestroy":
+		return cli.LxcDestroy(ctx, arg(0), flags["v"] == "true")
+	case "LxcStart":
+		return cli.LxcStart(ctx, arg(0))
+	case "LxcStop":
+		return cli.LxcStop(ctx, arg(0))
+	case "LxcList":
+		return print(cli.LxcList(ctx, arg(0), flags["c"] == "true", flags["t"] == "true",
+			flags["i"] == "true", flags["a"] == "true", flags["p"] == "true"))
+	case "LxcQuota":
+		return print(cli.LxcQuota(ctx, arg(0), arg(1), flags["s"], flags["t"]))
+	case "MapPort":
+		return cli.MapPort(ctx, arg(0), flags["i"], flags["e"], flags["p"], flags["d"], flags["c"], flags["r"] == "true")
+	case "Info":
+		return print(cli.Info(ctx, arg(0), arg(1), arg(2)))
+	case "LxcAttach":
+		return cli.LxcAttach(ctx, arg(0), args[1:])
+	case "LxcRename":
+		return cli.LxcRename(ctx, arg(0), arg(1))
+	case "Export":
+		return print(cli.Export(ctx, arg(0), flags["v"]))
+	case "Import":
+		return cli.Import(ctx, arg(0), flags["t"], flags["k"])
+	case "Backup":
+		return print(cli.Backup(ctx, arg(0), flags["v"]))
+	case "Cleanup":
+		return cli.Cleanup(ctx, arg(0))
+	case "Demote":
+		return cli.Demote(ctx, arg(0), arg(1))
+	case "SetContainerConfig":
+		return print(cli.SetContainerConfig(ctx, arg(0), arg(1), arg(2)))
+	case "ProxyAdd":
+		return cli.ProxyAdd(ctx, arg(0), flags["p"], flags["d"], flags["c"])
+	case "ProxyDel":
+		return cli.ProxyDel(ctx, arg(0), flags["d"])
+	case "ProxyCheck":
+		return print(cli.ProxyCheck(ctx, arg(0)))
+	case "VxlanTunnel":
+		return cli.VxlanTunnel(ctx, arg(0), flags["vlan"], flags["remote"], flags["r"] == "true")
+	case "P2P":
+		return cli.P2P(ctx, arg(0), args[1:])
+	case "TunAdd":
+		return cli.TunAdd(ctx, arg(0))
+	case "TunDel":
+		return cli.TunDel(ctx, arg(0))
+	case "TunList":
+		return print(cli.TunList(ctx))
+	case "IngressLogin":
+		return ingress.Login()
+	case "IngressList":
+		return ingress.List()
+	case "IngressRouteAdd":
+		return ingress.RouteAdd(arg(0), flags["hostname"], flags["service"])
+	}
+	return errors.New("method " + method + " has no --legacy-root implementation")
+}
@@ -0,0 +1,349 @@
+// Command subutai is the unprivileged client half of the daemon/client
+// split. It keeps the exact command and flag surface the monolithic binary
+// used to expose, but every operation that touches a container or the host
+// network is marshaled into an RPC call to `subutaid` over
+// /var/run/subutai.sock instead of being executed in-process as root.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/subutai-io/agent/log"
+	"github.com/subutai-io/agent/pipeline"
+	"github.com/subutai-io/agent/rpc"
+
+	gcli "github.com/urfave/cli/v2"
+)
+
+var version = "unknown"
+var commit = "unknown"
+
+// legacyRoot, when set via --legacy-root, makes call() invoke the
+// privileged operation in-process instead of over RPC, matching the
+// pre-split, root-only behavior for hosts where subutaid isn't deployed.
+var legacyRoot bool
+
+// call dials subutaid, issues method with the given args/flags, prints any
+// output the daemon returned and surfaces daemon-side errors as CLI errors.
+// Under --legacy-root it instead runs the operation in-process as root.
+func call(method string, args []string, flags map[string]string) error {
+	if legacyRoot {
+		return callLegacy(method, args, flags)
+	}
+
+	client, err := rpc.Dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	out, err := client.Call(method, args, flags)
+	if len(out) > 0 {
+		fmt.Println(out)
+	}
+	return err
+}
+
+// flagString reads string flags named in names off the context into a map
+// keyed the same way subutaid's handlers expect.
+func flagString(c *gcli.Context, names ...string) map[string]string {
+	flags := make(map[string]string)
+	for _, n := range names {
+		flags[n] = c.String(n)
+	}
+	return flags
+}
+
+func flagBool(c *gcli.Context, names ...string) map[string]string {
+	flags := make(map[string]string)
+	for _, n := range names {
+		if c.Bool(n) {
+			flags[n] = "true"
+		}
+	}
+	return flags
+}
+
+func main() {
+	app := &gcli.App{}
+	app.Name = "Subutai"
+	app.Version = version + " " + commit
+	app.Usage = "unprivileged command line interface for the Subutai daemon"
+
+	app.Flags = []gcli.Flag{
+		&gcli.BoolFlag{Name: "d", Usage: "debug mode"},
+		&gcli.BoolFlag{Name: "legacy-root", Usage: "run privileged operations in-process as root instead of via subutaid"},
+	}
+
+	app.Before = func(c *gcli.Context) error {
+		log.ActivateSyslog("127.0.0.1:1514", "cli")
+		if c.Bool("d") {
+			log.Level(log.DebugLevel)
+		}
+		legacyRoot = c.Bool("legacy-root")
+		if legacyRoot && os.Getuid() != 0 {
+			return errors.New("--legacy-root requires running as root")
+		}
+		return nil
+	}
+
+	app.Commands = []*gcli.Command{applyCommand, capsCommand, {
+		Name:     "clone",
+		Usage:    "clone Subutai container",
+		Category: "Container",
+		Flags: []gcli.Flag{
+			&gcli.StringFlag{Name: "env", Aliases: []string{"e"}},
+			&gcli.StringFlag{Name: "ipaddr", Aliases: []string{"i"}},
+			&gcli.StringFlag{Name: "token", Aliases: []string{"t"}},
+			&gcli.StringFlag{Name: "kurjun", Aliases: []string{"k"}}},
+		Action: func(c *gcli.Context) error {
+			return call("LxcClone", []string{c.Args().Get(0), c.Args().Get(1)}, flagString(c, "e", "i", "t", "k"))
+		}}, {
+
+		Name:     "destroy",
+		Usage:    "destroy Subutai container",
+		Category: "Container",
+		Flags:    []gcli.Flag{&gcli.BoolFlag{Name: "vlan", Aliases: []string{"v"}}},
+		Action: func(c *gcli.Context) error {
+			return call("LxcDestroy", []string{c.Args().Get(0)}, flagBool(c, "v"))
+		}}, {
+
+		Name:     "start",
+		Usage:    "start Subutai container",
+		Category: "Container",
+		Action: func(c *gcli.Context) error {
+			return call("LxcStart", []string{c.Args().Get(0)}, nil)
+		}}, {
+
+		Name:     "stop",
+		Usage:    "stop Subutai container",
+		Category: "Container",
+		Action: func(c *gcli.Context) error {
+			return call("LxcStop", []string{c.Args().Get(0)}, nil)
+		}}, {
+
+		Name:     "list",
+		Usage:    "list Subutai container",
+		Category: "Host",
+		Flags: []gcli.Flag{
+			&gcli.BoolFlag{Name: "container", Aliases: []string{"c"}},
+			&gcli.BoolFlag{Name: "template", Aliases: []string{"t"}},
+			&gcli.BoolFlag{Name: "info", Aliases: []string{"i"}},
+			&gcli.BoolFlag{Name: "ancestor", Aliases: []string{"a"}},
+			&gcli.BoolFlag{Name: "parent", Aliases: []string{"p"}}},
+		Action: func(c *gcli.Context) error {
+			return call("LxcList", []string{c.Args().Get(0)}, flagBool(c, "c", "t", "i", "a", "p"))
+		}}, {
+
+		Name:     "quota",
+		Usage:    "set quotas for Subutai container",
+		Category: "Container",
+		Flags: []gcli.Flag{
+			&gcli.StringFlag{Name: "set", Aliases: []string{"s"}},
+			&gcli.StringFlag{Name: "threshold", Aliases: []string{"t"}}},
+		Action: func(c *gcli.Context) error {
+			return call("LxcQuota", []string{c.Args().Get(0), c.Args().Get(1)}, flagString(c, "s", "t"))
+		}}, {
+
+		Name:     "map",
+		Usage:    "Subutai port mapping",
+		Category: "Network",
+		Flags: []gcli.Flag{
+			&gcli.StringFlag{Name: "internal", Aliases: []string{"i"}},
+			&gcli.StringFlag{Name: "external", Aliases: []string{"e"}},
+			&gcli.StringFlag{Name: "domain", Aliases: []string{"d"}},
+			&gcli.StringFlag{Name: "cert", Aliases: []string{"c"}},
+			&gcli.StringFlag{Name: "policy", Aliases: []string{"p"}},
+			&gcli.BoolFlag{Name: "remove", Aliases: []string{"r"}}},
+		Action: func(c *gcli.Context) error {
+			flags := flagString(c, "i", "e", "p", "d", "c")
+			for k, v := range flagBool(c, "r") {
+				flags[k] = v
+			}
+			return call("MapPort", []string{c.Args().Get(0)}, flags)
+		}}, {
+
+		Name:     "info",
+		Usage:    "information about host system",
+		Category: "Host",
+		Action: func(c *gcli.Context) error {
+			return call("Info", []string{c.Args().Get(0), c.Args().Get(1), c.Args().Get(2)}, nil)
+		}}, {
+
+		Name:     "attach",
+		Usage:    "attach to Subutai container",
+		Category: "Container",
+		Action: func(c *gcli.Context) error {
+			return call("LxcAttach", append([]string{c.Args().Get(0)}, c.Args().Tail()...), nil)
+		}}, {
+
+		Name:     "rename",
+		Usage:    "rename Subutai container",
+		Category: "Container",
+		Action: func(c *gcli.Context) error {
+			return call("LxcRename", []string{c.Args().Get(0), c.Args().Get(1)}, nil)
+		}}, {
+
+		Name:     "export",
+		Usage:    "export Subutai container as a template",
+		Category: "Container",
+		Flags:    []gcli.Flag{&gcli.StringFlag{Name: "version", Aliases: []string{"v"}}},
+		Action: func(c *gcli.Context) error {
+			return call("Export", []string{c.Args().Get(0)}, flagString(c, "v"))
+		}}, {
+
+		Name:     "import",
+		Usage:    "import a Subutai template",
+		Category: "Container",
+		Flags: []gcli.Flag{
+			&gcli.StringFlag{Name: "token", Aliases: []string{"t"}},
+			&gcli.StringFlag{Name: "kurjun", Aliases: []string{"k"}}},
+		Action: func(c *gcli.Context) error {
+			return call("Import", []string{c.Args().Get(0)}, flagString(c, "t", "k"))
+		}}, {
+
+		Name:     "backup",
+		Usage:    "back up Subutai container",
+		Category: "Container",
+		Flags:    []gcli.Flag{&gcli.StringFlag{Name: "volume", Aliases: []string{"v"}}},
+		Action: func(c *gcli.Context) error {
+			return call("Backup", []string{c.Args().Get(0)}, flagString(c, "v"))
+		}}, {
+
+		Name:     "cleanup",
+		Usage:    "remove a failed or partially-applied container",
+		Category: "Container",
+		Action: func(c *gcli.Context) error {
+			return call("Cleanup", []string{c.Args().Get(0)}, nil)
+		}}, {
+
+		Name:     "demote",
+		Usage:    "demote container to Resource Host",
+		Category: "Container",
+		Action: func(c *gcli.Context) error {
+			return call("Demote", []string{c.Args().Get(0), c.Args().Get(1)}, nil)
+		}}, {
+
+		Name:     "config",
+		Usage:    "get or set a Subutai container config item",
+		Category: "Container",
+		Action: func(c *gcli.Context) error {
+			return call("SetContainerConfig", []string{c.Args().Get(0), c.Args().Get(1), c.Args().Get(2)}, nil)
+		}}, {
+
+		Name:     "batch",
+		Usage:    "run a batch file of subutai commands",
+		Category: "Host",
+		Flags:    []gcli.Flag{&gcli.StringFlag{Name: "file", Aliases: []string{"f"}}},
+		Action: func(c *gcli.Context) error {
+			if c.String("f") == "" {
+				return errors.New("-f batch-file is required")
+			}
+			return runBatch(c.String("f"))
+		}}, {
+
+		Name:     "proxy",
+		Usage:    "manage reverse proxy rules for a container",
+		Category: "Network",
+		Subcommands: []*gcli.Command{{
+			Name:  "add",
+			Flags: []gcli.Flag{
+				&gcli.StringFlag{Name: "port", Aliases: []string{"p"}},
+				&gcli.StringFlag{Name: "domain", Aliases: []string{"d"}},
+				&gcli.StringFlag{Name: "cert", Aliases: []string{"c"}}},
+			Action: func(c *gcli.Context) error {
+				return call("ProxyAdd", []string{c.Args().Get(0)}, flagString(c, "p", "d", "c"))
+			},
+		}, {
+			Name:  "del",
+			Flags: []gcli.Flag{&gcli.StringFlag{Name: "domain", Aliases: []string{"d"}}},
+			Action: func(c *gcli.Context) error {
+				return call("ProxyDel", []string{c.Args().Get(0)}, flagString(c, "d"))
+			},
+		}, {
+			Name: "check",
+			Action: func(c *gcli.Context) error {
+				return call("ProxyCheck", []string{c.Args().Get(0)}, nil)
+			},
+		}}}, {
+
+		Name:     "vxlan",
+		Usage:    "manage vxlan tunnels between Resource Hosts",
+		Category: "Network",
+		Flags: []gcli.Flag{
+			&gcli.StringFlag{Name: "vlan"},
+			&gcli.StringFlag{Name: "remote"},
+			&gcli.BoolFlag{Name: "remove", Aliases: []string{"r"}}},
+		Action: func(c *gcli.Context) error {
+			flags := flagString(c, "vlan", "remote")
+			for k, v := range flagBool(c, "r") {
+				flags[k] = v
+			}
+			return call("VxlanTunnel", []string{c.Args().Get(0)}, flags)
+		}}, {
+
+		Name:     "p2p",
+		Usage:    "manage the P2P mesh network",
+		Category: "Network",
+		Action: func(c *gcli.Context) error {
+			return call("P2P", append([]string{c.Args().Get(0)}, c.Args().Tail()...), nil)
+		}}, {
+
+		Name:     "tunnel",
+		Usage:    "manage SSH tunnels to containers",
+		Category: "Network",
+		Subcommands: []*gcli.Command{{
+			Name: "add",
+			Action: func(c *gcli.Context) error {
+				return call("TunAdd", []string{c.Args().Get(0)}, nil)
+			},
+		}, {
+			Name: "del",
+			Action: func(c *gcli.Context) error {
+				return call("TunDel", []string{c.Args().Get(0)}, nil)
+			},
+		}, {
+			Name: "list",
+			Action: func(c *gcli.Context) error {
+				return call("TunList", nil, nil)
+			},
+		}}}, {
+
+		Name:     "metrics",
+		Usage:    "Subutai metrics",
+		Category: "Host",
+		Subcommands: []*gcli.Command{{
+			Name:  "serve",
+			Usage: "expose a Prometheus /metrics endpoint (and push to OTLP if configured)",
+			Flags: []gcli.Flag{&gcli.StringFlag{Name: "bind", Usage: "address to serve /metrics on"}},
+			Action: func(c *gcli.Context) error {
+				return call("MetricsServe", nil, flagString(c, "bind"))
+			},
+		}}}, {
+
+		Name:     "ingress",
+		Usage:    "secure ingress tunnel to expose container endpoints",
+		Category: "Network",
+		Subcommands: []*gcli.Command{
+			{Name: "login", Action: func(c *gcli.Context) error { return call("IngressLogin", nil, nil) }},
+			{Name: "list", Action: func(c *gcli.Context) error { return call("IngressList", nil, nil) }},
+			{
+				Name:  "route",
+				Usage: "manage ingress routes",
+				Subcommands: []*gcli.Command{{
+					Name:  "add",
+					Flags: []gcli.Flag{&gcli.StringFlag{Name: "hostname"}, &gcli.StringFlag{Name: "service"}},
+					Action: func(c *gcli.Context) error {
+						return call("IngressRouteAdd", []string{c.Args().Get(0)}, flagString(c, "hostname", "service"))
+					},
+				}},
+			},
+		}},
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		log.Error(err.Error())
+	}
+}
@@ -0,0 +1,212 @@
+// Command subutaid is the privileged control-plane daemon. It owns every
+// container and network operation that used to live in the monolithic
+// `subutai` binary, exposes them over a versioned RPC surface on a local
+// Unix socket, and runs the long-lived agent loop that the `subutai daemon`
+// subcommand used to start in-process.
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/subutai-io/agent/agent"
+	"github.com/subutai-io/agent/caps"
+	"github.com/subutai-io/agent/cli"
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/ingress"
+	"github.com/subutai-io/agent/lib/fs"
+	"github.com/subutai-io/agent/log"
+	"github.com/subutai-io/agent/metrics"
+	"github.com/subutai-io/agent/rpc"
+)
+
+// qgroupMaintenanceInterval is how often the qgroup reconciliation pass
+// re-runs after its initial, start-of-day run.
+const qgroupMaintenanceInterval = 30 * time.Minute
+
+func main() {
+	if os.Getuid() != 0 {
+		log.Error("subutaid must run as root")
+	}
+	log.ActivateSyslog("127.0.0.1:1514", "subutaid")
+
+	server, err := rpc.NewServer()
+	log.Check(log.FatalLevel, "Starting RPC listener on "+rpc.SockPath, err)
+
+	// A method that declares no capability (caps.RequiresRoot is false) is
+	// served to any local caller; every other method is served only to root
+	// or to the `subutai` service account (config.Agent.ServiceUID).
+	server.AllowUID = func(method string, uid uint32) bool {
+		if !caps.RequiresRoot(method) {
+			return true
+		}
+		return uid == 0 || uid == config.Agent.ServiceUID
+	}
+
+	// dropPrivileges has no capability re-acquisition path yet (see its
+	// doc comment) and does not actually deliver non-root operation - it
+	// refuses to run and fails startup rather than silently crippling
+	// every privileged RPC method. config.Agent.DropPrivileges defaults
+	// to false and must not be set until that mechanism exists;
+	// LegacyRoot continues to additionally force the daemon to stay root
+	// regardless.
+	if config.Agent.DropPrivileges && !config.Agent.LegacyRoot {
+		dropPrivileges()
+	}
+
+	registerHandlers(server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-sigCh
+		log.Info("Received " + sig.String() + ", shutting down")
+		cancel()
+		log.Check(log.WarnLevel, "Closing RPC listener", server.Close())
+	}()
+
+	if len(config.Agent.IngressBroker) > 0 {
+		go func() {
+			log.Check(log.ErrorLevel, "Running ingress tunnel", ingress.Run())
+		}()
+	}
+	if len(config.Agent.MetricsBind) > 0 {
+		go func() {
+			log.Check(log.ErrorLevel, "Running metrics exporter", metrics.Serve(ctx, config.Agent.MetricsBind))
+		}()
+	}
+	if len(config.Agent.TransferBind) > 0 {
+		go func() {
+			log.Check(log.ErrorLevel, "Serving template transfer endpoint",
+				http.ListenAndServe(config.Agent.TransferBind, fs.TransferHandler()))
+		}()
+	}
+	go agent.Start(ctx)
+	go runQgroupMaintenance()
+
+	log.Check(log.FatalLevel, "Serving RPC", server.Serve())
+}
+
+// runQgroupMaintenance reconciles btrfs qgroups once at startup and then
+// every qgroupMaintenanceInterval, cleaning up after any SubvolumeDestroy
+// that failed partway or any leftover qgroup an older agent left behind.
+func runQgroupMaintenance() {
+	fs.Maintenance()
+
+	ticker := time.NewTicker(qgroupMaintenanceInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		fs.Maintenance()
+	}
+}
+
+// registerHandlers binds every RPC method name to the existing privileged
+// `cli` package function it replaces direct in-process calls to.
+func registerHandlers(s *rpc.Server) {
+	arg := func(req rpc.Request, i int) string {
+		if i < len(req.Args) {
+			return req.Args[i]
+		}
+		return ""
+	}
+
+	s.Register("LxcAttach", func(req rpc.Request) (string, error) {
+		return "", cli.LxcAttach(context.Background(), arg(req, 0), req.Args[1:])
+	})
+	s.Register("LxcClone", func(req rpc.Request) (string, error) {
+		return "", cli.LxcClone(context.Background(), arg(req, 0), arg(req, 1),
+			req.Flags["e"], req.Flags["i"], req.Flags["t"], req.Flags["k"])
+	})
+	s.Register("LxcDestroy", func(req rpc.Request) (string, error) {
+		return "", cli.LxcDestroy(context.Background(), arg(req, 0), req.Flags["v"] == "true")
+	})
+	s.Register("LxcStart", func(req rpc.Request) (string, error) {
+		return "", cli.LxcStart(context.Background(), arg(req, 0))
+	})
+	s.Register("LxcStop", func(req rpc.Request) (string, error) {
+		return "", cli.LxcStop(context.Background(), arg(req, 0))
+	})
+	s.Register("LxcList", func(req rpc.Request) (string, error) {
+		return cli.LxcList(context.Background(), arg(req, 0),
+			req.Flags["c"] == "true", req.Flags["t"] == "true", req.Flags["i"] == "true",
+			req.Flags["a"] == "true", req.Flags["p"] == "true")
+	})
+	s.Register("LxcQuota", func(req rpc.Request) (string, error) {
+		return cli.LxcQuota(context.Background(), arg(req, 0), arg(req, 1), req.Flags["s"], req.Flags["t"])
+	})
+	s.Register("MapPort", func(req rpc.Request) (string, error) {
+		return "", cli.MapPort(context.Background(), arg(req, 0), req.Flags["i"], req.Flags["e"],
+			req.Flags["p"], req.Flags["d"], req.Flags["c"], req.Flags["r"] == "true")
+	})
+	s.Register("Info", func(req rpc.Request) (string, error) {
+		return cli.Info(context.Background(), arg(req, 0), arg(req, 1), arg(req, 2))
+	})
+	s.Register("MetricsServe", func(req rpc.Request) (string, error) {
+		bind := req.Flags["bind"]
+		if bind == "" {
+			bind = config.Agent.MetricsBind
+		}
+		return "", metrics.Serve(context.Background(), bind)
+	})
+
+	s.Register("LxcRename", func(req rpc.Request) (string, error) {
+		return "", cli.LxcRename(context.Background(), arg(req, 0), arg(req, 1))
+	})
+	s.Register("Export", func(req rpc.Request) (string, error) {
+		return cli.Export(context.Background(), arg(req, 0), req.Flags["v"])
+	})
+	s.Register("Import", func(req rpc.Request) (string, error) {
+		return "", cli.Import(context.Background(), arg(req, 0), req.Flags["t"], req.Flags["k"])
+	})
+	s.Register("Backup", func(req rpc.Request) (string, error) {
+		return cli.Backup(context.Background(), arg(req, 0), req.Flags["v"])
+	})
+	s.Register("Cleanup", func(req rpc.Request) (string, error) {
+		return "", cli.Cleanup(context.Background(), arg(req, 0))
+	})
+	s.Register("Demote", func(req rpc.Request) (string, error) {
+		return "", cli.Demote(context.Background(), arg(req, 0), arg(req, 1))
+	})
+	s.Register("SetContainerConfig", func(req rpc.Request) (string, error) {
+		return cli.SetContainerConfig(context.Background(), arg(req, 0), arg(req, 1), arg(req, 2))
+	})
+	s.Register("ProxyAdd", func(req rpc.Request) (string, error) {
+		return "", cli.ProxyAdd(context.Background(), arg(req, 0), req.Flags["p"], req.Flags["d"], req.Flags["c"])
+	})
+	s.Register("ProxyDel", func(req rpc.Request) (string, error) {
+		return "", cli.ProxyDel(context.Background(), arg(req, 0), req.Flags["d"])
+	})
+	s.Register("ProxyCheck", func(req rpc.Request) (string, error) {
+		return cli.ProxyCheck(context.Background(), arg(req, 0))
+	})
+	s.Register("VxlanTunnel", func(req rpc.Request) (string, error) {
+		return "", cli.VxlanTunnel(context.Background(), arg(req, 0), req.Flags["vlan"], req.Flags["remote"],
+			req.Flags["r"] == "true")
+	})
+	s.Register("P2P", func(req rpc.Request) (string, error) {
+		return "", cli.P2P(context.Background(), arg(req, 0), req.Args[1:])
+	})
+	s.Register("TunAdd", func(req rpc.Request) (string, error) {
+		return "", cli.TunAdd(context.Background(), arg(req, 0))
+	})
+	s.Register("TunDel", func(req rpc.Request) (string, error) {
+		return "", cli.TunDel(context.Background(), arg(req, 0))
+	})
+	s.Register("TunList", func(req rpc.Request) (string, error) {
+		return cli.TunList(context.Background())
+	})
+	s.Register("IngressLogin", func(req rpc.Request) (string, error) {
+		return "", ingress.Login()
+	})
+	s.Register("IngressList", func(req rpc.Request) (string, error) {
+		return "", ingress.List()
+	})
+	s.Register("IngressRouteAdd", func(req rpc.Request) (string, error) {
+		return "", ingress.RouteAdd(arg(req, 0), req.Flags["hostname"], req.Flags["service"])
+	})
+}
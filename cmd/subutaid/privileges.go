@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/subutai-io/agent/log"
+)
+
+// serviceUser is the unprivileged account subutaid would drop to once it
+// has bound its listening socket.
+//
+// dropPrivileges does NOT currently implement non-root operation: there is
+// no capability re-acquisition path, every handler in registerHandlers
+// calls straight into the `cli` package in-process rather than through a
+// setuid helper or a per-call re-exec, so nothing hands capabilities back
+// once Setuid/Setgid run. Dropping to serviceUser here would permanently
+// break every CAP_SYS_ADMIN/CAP_NET_ADMIN method (LxcClone, LxcDestroy,
+// LxcStart/Stop, LxcQuota, MapPort) for the rest of the process's life.
+// Rather than let config.Agent.DropPrivileges silently cripple the daemon
+// if it's ever set, dropPrivileges refuses to run and fails startup
+// loudly instead - this flag is scaffolding for a future real
+// capability-drop mechanism, not a working one, and is treated as such.
+const serviceUser = "subutai"
+
+// dropPrivileges is not yet safe to call: see the package-level warning
+// above. It deliberately does not switch uid/gid and instead fails
+// startup, so config.Agent.DropPrivileges cannot silently produce a
+// daemon that's locked out of its own privileged RPC methods.
+func dropPrivileges() {
+	log.Error("DropPrivileges is enabled but not implemented: subutaid has no capability re-acquisition path yet, so dropping to " + serviceUser + " would permanently break every privileged RPC method; refusing to start")
+}
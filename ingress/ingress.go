@@ -0,0 +1,344 @@
+// Package ingress implements a Cloudflare-Tunnel style secure ingress client.
+//
+// It keeps a single outbound, multiplexed HTTP/2 session open to a remote
+// broker so that HTTP(S) endpoints running inside Subutai containers can be
+// reached from the outside world without opening any inbound port on the
+// Resource Host. Routes are registered into the same reverse-proxy tables
+// that `cli.MapPort` already maintains.
+package ingress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/subutai-io/agent/cli"
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/log"
+)
+
+// tokenPath is where the OAuth-style broker token is cached between runs.
+const tokenPath = "/var/lib/subutai/ingress.token"
+
+// routesPath persists locally registered routes across agent restarts, so
+// Run doesn't need a fresh `route add` after every daemon restart to
+// re-advertise what it can forward.
+const routesPath = "/var/lib/subutai/ingress.routes.json"
+
+// Route describes one exposed container endpoint.
+type Route struct {
+	Container string `json:"container"`
+	Hostname  string `json:"hostname"`
+	Service   string `json:"service"`
+}
+
+// token is the cached broker credential used to authenticate the tunnel session.
+type token struct {
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Login performs an OAuth-style token fetch against the configured control
+// plane and caches the resulting token under /var/lib/subutai.
+func Login() error {
+	if len(config.Agent.IngressBroker) == 0 {
+		return errors.New("ingress broker is not configured")
+	}
+
+	resp, err := http.Post(config.Agent.IngressBroker+"/oauth/device", "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var tok token
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return err
+	}
+
+	log.Check(log.FatalLevel, "Creating /var/lib/subutai", os.MkdirAll(filepath.Dir(tokenPath), 0700))
+
+	data, err := json.Marshal(tok)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(tokenPath, data, 0600)
+}
+
+// loadToken reads the cached broker token, failing if Login was never run.
+func loadToken() (token, error) {
+	var tok token
+	data, err := ioutil.ReadFile(tokenPath)
+	if err != nil {
+		return tok, errors.New("not logged in, run `subutai ingress login` first")
+	}
+	err = json.Unmarshal(data, &tok)
+	return tok, err
+}
+
+// routesMu guards routes, which connect's request-handling goroutines read
+// concurrently with RouteAdd registering new ones.
+var (
+	routesMu sync.RWMutex
+	routes   = map[string]Route{}
+)
+
+// RouteAdd registers a new hostname -> container service mapping, persists
+// it into the existing MapPort reverse-proxy tables, and adds it to the set
+// Run advertises to the broker so inbound tunnel traffic for hostname gets
+// forwarded to service.
+func RouteAdd(container, hostname, service string) error {
+	if container == "" || hostname == "" || service == "" {
+		return errors.New("container, hostname and service are required")
+	}
+	cli.MapPort(container, service, "", "", hostname, "", false)
+
+	routesMu.Lock()
+	routes[hostname] = Route{Container: container, Hostname: hostname, Service: service}
+	routesMu.Unlock()
+	log.Check(log.WarnLevel, "Persisting ingress routes", saveRoutes())
+
+	log.Info("Registered ingress route " + hostname + " -> " + service + " (" + container + ")")
+	return nil
+}
+
+// List prints the routes currently registered through ingress.
+func List() error {
+	if err := loadRoutes(); err != nil {
+		return err
+	}
+	routesMu.RLock()
+	defer routesMu.RUnlock()
+	for _, r := range routes {
+		fmt.Println(r.Hostname + " -> " + r.Service + " (" + r.Container + ")")
+	}
+	return nil
+}
+
+// loadRoutes restores routes persisted by a previous RouteAdd, so a
+// restarted Run can advertise them to the broker without the operator
+// re-running `route add`.
+func loadRoutes() error {
+	data, err := ioutil.ReadFile(routesPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var loaded []Route
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return err
+	}
+
+	routesMu.Lock()
+	for _, r := range loaded {
+		routes[r.Hostname] = r
+	}
+	routesMu.Unlock()
+	return nil
+}
+
+func saveRoutes() error {
+	routesMu.RLock()
+	list := make([]Route, 0, len(routes))
+	for _, r := range routes {
+		list = append(list, r)
+	}
+	routesMu.RUnlock()
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	log.Check(log.WarnLevel, "Creating /var/lib/subutai", os.MkdirAll(filepath.Dir(routesPath), 0700))
+	return ioutil.WriteFile(routesPath, data, 0600)
+}
+
+const (
+	minReconnectBackoff = 5 * time.Second
+	maxReconnectBackoff = 2 * time.Minute
+)
+
+// Run starts the persistent outbound session to the broker and keeps it
+// alive across reconnects, backing off exponentially between attempts
+// instead of hammering the broker (or the log) every 5 seconds forever
+// when it's unreachable. It is meant to be launched as a daemon
+// sub-goroutine so the tunnel survives agent restarts.
+func Run() error {
+	tok, err := loadToken()
+	if err != nil {
+		return err
+	}
+	log.Check(log.WarnLevel, "Loading persisted ingress routes", loadRoutes())
+
+	backoff := minReconnectBackoff
+	for {
+		err := connect(tok)
+		log.Warn("Ingress tunnel session ended: " + err.Error())
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxReconnectBackoff {
+			backoff = maxReconnectBackoff
+		}
+	}
+}
+
+// frame is one message on the tunnel's newline-delimited JSON wire
+// protocol, carried over a single long-lived HTTP/2 stream (the request
+// body flows client->broker, the response body flows broker->client; HTTP/2
+// multiplexing lets both be written/read concurrently on the same
+// connection, unlike HTTP/1.1). A request frame (Method set) carries one
+// complete forwarded HTTP request body in Body; the matching response is
+// sent back as a single frame on the same Stream. Large request/response
+// bodies aren't chunked across frames - that would need a second Stream
+// sequence number per side, which the broker's protocol this was written
+// against doesn't define.
+type frame struct {
+	Stream int         `json:"stream"`
+	Method string      `json:"method,omitempty"`
+	Path   string      `json:"path,omitempty"`
+	Host   string      `json:"host,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Status int         `json:"status,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+	EOF    bool        `json:"eof,omitempty"`
+}
+
+// connect dials the broker over HTTP/2 and serves forwarded requests back
+// to the local MapPort-registered sockets until the session breaks.
+func connect(tok token) error {
+	if len(config.Agent.IngressBroker) == 0 {
+		return errors.New("ingress broker is not configured")
+	}
+
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, config.Agent.IngressBroker+"/tunnel", pr)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+tok.AccessToken)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		pw.Close()
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		pw.Close()
+		return errors.New("broker handshake: " + resp.Status)
+	}
+
+	var writeMu sync.Mutex
+	send := func(f frame) error {
+		data, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		_, err = pw.Write(append(data, '\n'))
+		return err
+	}
+
+	// The hostnames this session can serve are advertised as the first
+	// frames the broker reads off the request body.
+	routesMu.RLock()
+	for hostname := range routes {
+		send(frame{Host: hostname})
+	}
+	routesMu.RUnlock()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var f frame
+		if err := json.Unmarshal(scanner.Bytes(), &f); err != nil {
+			log.Warn("Ingress tunnel: malformed frame: " + err.Error())
+			continue
+		}
+		if f.Method != "" {
+			go serveForwardedRequest(f, send)
+		}
+	}
+
+	pw.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return errors.New("broker closed the tunnel session")
+}
+
+// requestCountsMu guards requestCounts, the cumulative per-hostname count of
+// requests this session has forwarded, exposed to the metrics package
+// through RequestCounts so it can export subutai_proxy_requests_total.
+var (
+	requestCountsMu sync.Mutex
+	requestCounts   = map[string]int64{}
+)
+
+// RequestCounts returns the cumulative number of tunnel-forwarded requests
+// served for each hostname since this process started. It only counts
+// traffic that arrived through the ingress broker tunnel, not requests
+// nginx proxies directly for a MapPort route that doesn't go through
+// ingress at all.
+func RequestCounts() map[string]int64 {
+	requestCountsMu.Lock()
+	defer requestCountsMu.Unlock()
+
+	counts := make(map[string]int64, len(requestCounts))
+	for k, v := range requestCounts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// serveForwardedRequest proxies one broker-forwarded request to the local
+// service registered for its Host and sends the response back as a single
+// frame on the same Stream ID.
+func serveForwardedRequest(f frame, send func(frame) error) {
+	requestCountsMu.Lock()
+	requestCounts[f.Host]++
+	requestCountsMu.Unlock()
+
+	routesMu.RLock()
+	route, ok := routes[f.Host]
+	routesMu.RUnlock()
+	if !ok {
+		log.Check(log.WarnLevel, "Replying to forwarded request for unknown host "+f.Host,
+			send(frame{Stream: f.Stream, Status: http.StatusNotFound, EOF: true}))
+		return
+	}
+
+	req, err := http.NewRequest(f.Method, "http://"+route.Service+f.Path, bytes.NewReader(f.Body))
+	if log.Check(log.WarnLevel, "Building forwarded request for "+f.Host, err) {
+		log.Check(log.WarnLevel, "Replying to forwarded request for "+f.Host,
+			send(frame{Stream: f.Stream, Status: http.StatusBadGateway, EOF: true}))
+		return
+	}
+	req.Header = f.Header
+
+	resp, err := http.DefaultClient.Do(req)
+	if log.Check(log.WarnLevel, "Forwarding request to "+route.Service, err) {
+		log.Check(log.WarnLevel, "Replying to forwarded request for "+f.Host,
+			send(frame{Stream: f.Stream, Status: http.StatusBadGateway, EOF: true}))
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	log.Check(log.WarnLevel, "Reading response from "+route.Service, err)
+	log.Check(log.WarnLevel, "Replying to forwarded request for "+f.Host,
+		send(frame{Stream: f.Stream, Status: resp.StatusCode, Header: resp.Header, Body: body, EOF: true}))
+}
@@ -0,0 +1,119 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/log"
+
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+// diskQuotaPattern matches the human-readable rate QuotaDisk accepts: a
+// byte throughput with a unit suffix ("10MB", "512KB") or an IOPS cap
+// ("500iops").
+var diskQuotaPattern = regexp.MustCompile(`^(\d+)(B|KB|MB|GB|iops)$`)
+
+// parseDiskQuota splits a QuotaDisk size argument into a bytes-per-second
+// throughput limit and an IOPS limit; whichever one the argument doesn't
+// specify is returned as 0, meaning "unlimited".
+func parseDiskQuota(size string) (bps, iops int64, err error) {
+	m := diskQuotaPattern.FindStringSubmatch(size)
+	if m == nil {
+		return 0, 0, errors.New("invalid disk quota: " + size)
+	}
+	value, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch m[2] {
+	case "iops":
+		return 0, value, nil
+	case "KB":
+		return value * 1024, 0, nil
+	case "MB":
+		return value * 1024 * 1024, 0, nil
+	case "GB":
+		return value * 1024 * 1024 * 1024, 0, nil
+	default:
+		return value, 0, nil
+	}
+}
+
+// blockDevice returns the major:minor device number backing path, for
+// blkio.throttle.*_device and io.max, which key limits by device.
+func blockDevice(path string) (devno string, err error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d", unix.Major(st.Dev), unix.Minor(st.Dev)), nil
+}
+
+// QuotaDisk sets per-container block I/O throughput and IOPS limits on the
+// btrfs device underlying config.Agent.LxcPrefix and returns the persisted
+// limit. size accepts a human-readable byte rate ("10MB") or an IOPS cap
+// ("500iops"), matching one direction (read and write are limited equally)
+// per call; pass "" to read back the currently persisted limit.
+func QuotaDisk(name string, size ...string) string {
+	confPath := config.Agent.LxcPrefix + name + "/config"
+	if len(size) == 0 || size[0] == "" {
+		return GetConfigItem(confPath, "subutai.disk.ratelimit")
+	}
+
+	dev, err := blockDevice(config.Agent.LxcPrefix)
+	if log.Check(log.WarnLevel, "Resolving block device for "+config.Agent.LxcPrefix, err) {
+		return ""
+	}
+	bps, iops, err := parseDiskQuota(size[0])
+	if log.Check(log.WarnLevel, "Parsing disk quota "+size[0], err) {
+		return ""
+	}
+
+	c, err := lxc.NewContainer(name, config.Agent.LxcPrefix)
+	log.Check(log.WarnLevel, "Looking for container: "+name, err)
+
+	conf := [][]string{{"subutai.disk.ratelimit", size[0]}}
+
+	if isCgroupV2() {
+		value := fmt.Sprintf("%s rbps=%s wbps=%s riops=%s wiops=%s", dev, ioLimit(bps), ioLimit(bps), ioLimit(iops), ioLimit(iops))
+		log.Check(log.DebugLevel, "Setting io.max", c.SetCgroupItem("io.max", value))
+		conf = append(conf, []string{"lxc.cgroup2.blkio.io.max", value})
+		SetContainerConf(name, conf)
+		return size[0]
+	}
+
+	for _, limit := range []struct {
+		item, confKey string
+		value         int64
+	}{
+		{"blkio.throttle.read_bps_device", "lxc.cgroup.blkio.throttle.read_bps_device", bps},
+		{"blkio.throttle.write_bps_device", "lxc.cgroup.blkio.throttle.write_bps_device", bps},
+		{"blkio.throttle.read_iops_device", "lxc.cgroup.blkio.throttle.read_iops_device", iops},
+		{"blkio.throttle.write_iops_device", "lxc.cgroup.blkio.throttle.write_iops_device", iops},
+	} {
+		if limit.value <= 0 {
+			continue
+		}
+		value := dev + " " + strconv.FormatInt(limit.value, 10)
+		log.Check(log.DebugLevel, "Setting "+limit.item, c.SetCgroupItem(limit.item, value))
+		conf = append(conf, []string{limit.confKey, value})
+	}
+
+	SetContainerConf(name, conf)
+	return size[0]
+}
+
+// ioLimit renders a cgroup v2 io.max field value, "max" meaning unlimited.
+func ioLimit(v int64) string {
+	if v <= 0 {
+		return "max"
+	}
+	return strconv.FormatInt(v, 10)
+}
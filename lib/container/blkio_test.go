@@ -0,0 +1,42 @@
+package container
+
+import "testing"
+
+func TestParseDiskQuota(t *testing.T) {
+	cases := []struct {
+		in        string
+		bps, iops int64
+		wantErr   bool
+	}{
+		{in: "10MB", bps: 10 * 1024 * 1024},
+		{in: "512KB", bps: 512 * 1024},
+		{in: "1GB", bps: 1024 * 1024 * 1024},
+		{in: "500iops", iops: 500},
+		{in: "bogus", wantErr: true},
+	}
+
+	for _, c := range cases {
+		bps, iops, err := parseDiskQuota(c.in)
+		if c.wantErr {
+			if err == nil {
+				t.Fatalf("%s: expected error", c.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.in, err)
+		}
+		if bps != c.bps || iops != c.iops {
+			t.Fatalf("%s: got bps=%d iops=%d, want bps=%d iops=%d", c.in, bps, iops, c.bps, c.iops)
+		}
+	}
+}
+
+func TestIOLimit(t *testing.T) {
+	if got := ioLimit(0); got != "max" {
+		t.Fatalf("got %s", got)
+	}
+	if got := ioLimit(100); got != "100" {
+		t.Fatalf("got %s", got)
+	}
+}
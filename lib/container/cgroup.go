@@ -0,0 +1,102 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/subutai-io/agent/config"
+)
+
+// cgroupV2ControllersPath is the file whose presence indicates the host
+// mounts the unified (v2) cgroup hierarchy instead of the legacy,
+// per-controller v1 hierarchy.
+const cgroupV2ControllersPath = "/sys/fs/cgroup/cgroup.controllers"
+
+// cgroupV2Probe detects which hierarchy is mounted; it's a var so tests can
+// fake either environment without touching /sys.
+var cgroupV2Probe = func() bool {
+	_, err := os.Stat(cgroupV2ControllersPath)
+	return err == nil
+}
+
+// isCgroupV2 reports whether the host uses the unified cgroup hierarchy.
+func isCgroupV2() bool {
+	return cgroupV2Probe()
+}
+
+// memoryConfigItem returns the live cgroup key and persisted lxc.* config
+// key/value QuotaRAM should write for limitBytes, for whichever hierarchy
+// is active.
+func memoryConfigItem(limitBytes int64) (cgroupItem, confKey, confValue string) {
+	if isCgroupV2() {
+		v := strconv.FormatInt(limitBytes, 10)
+		return "memory.max", "lxc.cgroup2.memory.max", v
+	}
+	return "memory.limit_in_bytes", "lxc.cgroup.memory.limit_in_bytes", strconv.FormatInt(limitBytes/1024/1024, 10) + "M"
+}
+
+// cpuQuotaConfigItem returns the live cgroup key/value and persisted
+// lxc.* config key/value QuotaCPU should write for a cfs_quota_us value of
+// quotaUs over periodUs, for whichever hierarchy is active.
+func cpuQuotaConfigItem(quotaUs, periodUs int) (cgroupItem, cgroupValue, confKey, confValue string) {
+	if isCgroupV2() {
+		v := strconv.Itoa(quotaUs) + " " + strconv.Itoa(periodUs)
+		return "cpu.max", v, "lxc.cgroup2.cpu.max", v
+	}
+	v := strconv.Itoa(quotaUs)
+	return "cpu.cfs_quota_us", v, "lxc.cgroup.cpu.cfs_quota_us", v
+}
+
+// cpuQuotaFromCgroup parses the live cgroup quota value back into a
+// cfs_quota_us-equivalent integer, understanding both the v1 plain number
+// (where the kernel itself already reports -1 for "unlimited") and the v2
+// "<quota> <period>" form, whose "max" quota is v2's own spelling of
+// unlimited and is reported here as -1 too, for consistency with v1 and
+// with Resources.CPUQuota's documented sentinel.
+func cpuQuotaFromCgroup(value string) (int, error) {
+	if isCgroupV2() {
+		if strings.HasPrefix(value, "max ") || value == "max" {
+			return -1, nil
+		}
+		var quota, period int
+		if _, err := fmt.Sscan(value, &quota, &period); err != nil {
+			return 0, err
+		}
+		return quota, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// cgroupDelegatedProbe reports whether the calling (possibly unprivileged)
+// user can write the unified cgroup hierarchy directly; it's a var so tests
+// can fake either outcome. Rootless mode consults this before attempting a
+// live cgroup write that would otherwise require root or systemd delegation.
+var cgroupDelegatedProbe = func() bool {
+	f, err := os.OpenFile("/sys/fs/cgroup/cgroup.subtree_control", os.O_WRONLY, 0)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// cgroupWritable reports whether the current process may write cgroup
+// limits live; in privileged mode this is always true, in rootless mode it
+// depends on whether the unified hierarchy was delegated to this user.
+func cgroupWritable() bool {
+	if !config.Agent.Rootless {
+		return true
+	}
+	return isCgroupV2() && cgroupDelegatedProbe()
+}
+
+// cpuSetConfigKey returns the persisted lxc.* config key QuotaCPUset
+// should write cpuset.cpus under for whichever hierarchy is active.
+func cpuSetConfigKey() string {
+	if isCgroupV2() {
+		return "lxc.cgroup2.cpuset.cpus"
+	}
+	return "lxc.cgroup.cpuset.cpus"
+}
@@ -0,0 +1,116 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/subutai-io/agent/config"
+)
+
+func withCgroupHierarchy(v2 bool, fn func()) {
+	prev := cgroupV2Probe
+	cgroupV2Probe = func() bool { return v2 }
+	defer func() { cgroupV2Probe = prev }()
+	fn()
+}
+
+func TestMemoryConfigItem(t *testing.T) {
+	withCgroupHierarchy(false, func() {
+		item, key, value := memoryConfigItem(512 * 1024 * 1024)
+		if item != "memory.limit_in_bytes" || key != "lxc.cgroup.memory.limit_in_bytes" || value != "512M" {
+			t.Fatalf("unexpected v1 memory config: %s %s %s", item, key, value)
+		}
+	})
+
+	withCgroupHierarchy(true, func() {
+		item, key, value := memoryConfigItem(512 * 1024 * 1024)
+		if item != "memory.max" || key != "lxc.cgroup2.memory.max" || value != "536870912" {
+			t.Fatalf("unexpected v2 memory config: %s %s %s", item, key, value)
+		}
+	})
+}
+
+func TestCPUQuotaConfigItem(t *testing.T) {
+	withCgroupHierarchy(false, func() {
+		item, cgValue, key, confValue := cpuQuotaConfigItem(50000, 100000)
+		if item != "cpu.cfs_quota_us" || cgValue != "50000" || key != "lxc.cgroup.cpu.cfs_quota_us" || confValue != "50000" {
+			t.Fatalf("unexpected v1 cpu config: %s %s %s %s", item, cgValue, key, confValue)
+		}
+	})
+
+	withCgroupHierarchy(true, func() {
+		item, cgValue, key, confValue := cpuQuotaConfigItem(50000, 100000)
+		want := "50000 100000"
+		if item != "cpu.max" || cgValue != want || key != "lxc.cgroup2.cpu.max" || confValue != want {
+			t.Fatalf("unexpected v2 cpu config: %s %s %s %s", item, cgValue, key, confValue)
+		}
+	})
+}
+
+func TestCPUQuotaFromCgroup(t *testing.T) {
+	withCgroupHierarchy(false, func() {
+		got, err := cpuQuotaFromCgroup("50000")
+		if err != nil || got != 50000 {
+			t.Fatalf("got %d, %v", got, err)
+		}
+	})
+
+	withCgroupHierarchy(true, func() {
+		got, err := cpuQuotaFromCgroup("50000 100000")
+		if err != nil || got != 50000 {
+			t.Fatalf("got %d, %v", got, err)
+		}
+	})
+
+	withCgroupHierarchy(true, func() {
+		got, err := cpuQuotaFromCgroup("max 100000")
+		if err != nil || got != -1 {
+			t.Fatalf("got %d, %v, want -1 for the v2 unlimited sentinel", got, err)
+		}
+	})
+}
+
+func TestCgroupWritable(t *testing.T) {
+	prevRootless := config.Agent.Rootless
+	defer func() { config.Agent.Rootless = prevRootless }()
+
+	config.Agent.Rootless = false
+	if !cgroupWritable() {
+		t.Fatal("privileged mode must always report cgroup as writable")
+	}
+
+	config.Agent.Rootless = true
+	prevDelegated := cgroupDelegatedProbe
+	defer func() { cgroupDelegatedProbe = prevDelegated }()
+
+	withCgroupHierarchy(true, func() {
+		cgroupDelegatedProbe = func() bool { return true }
+		if !cgroupWritable() {
+			t.Fatal("rootless mode with delegated v2 hierarchy should be writable")
+		}
+
+		cgroupDelegatedProbe = func() bool { return false }
+		if cgroupWritable() {
+			t.Fatal("rootless mode without delegation must not be writable")
+		}
+	})
+
+	withCgroupHierarchy(false, func() {
+		cgroupDelegatedProbe = func() bool { return true }
+		if cgroupWritable() {
+			t.Fatal("rootless mode on the v1 hierarchy must not be writable")
+		}
+	})
+}
+
+func TestCPUSetConfigKey(t *testing.T) {
+	withCgroupHierarchy(false, func() {
+		if got := cpuSetConfigKey(); got != "lxc.cgroup.cpuset.cpus" {
+			t.Fatalf("got %s", got)
+		}
+	})
+	withCgroupHierarchy(true, func() {
+		if got := cpuSetConfigKey(); got != "lxc.cgroup2.cpuset.cpus" {
+			t.Fatalf("got %s", got)
+		}
+	})
+}
@@ -202,7 +202,7 @@ func Destroy(name string) {
 	if !log.Check(log.WarnLevel, "Creating container object", err) && c.State() == lxc.RUNNING {
 		log.Check(log.FatalLevel, "Stopping container", c.Stop())
 	}
-	fs.SubvolumeDestroy(config.Agent.LxcPrefix + name)
+	fs.Selected().SubvolumeDestroy(config.Agent.LxcPrefix + name)
 
 	db, err := db.New()
 	log.Check(log.WarnLevel, "Opening database", err)
@@ -228,13 +228,13 @@ func Clone(parent, child string) {
 	c, err := lxc.NewContainer(parent, config.Agent.LxcPrefix)
 	log.Check(log.FatalLevel, "Looking for container "+parent, err)
 
-	fs.SubvolumeCreate(config.Agent.LxcPrefix + child)
+	fs.Selected().SubvolumeCreate(config.Agent.LxcPrefix + child)
 	err = c.Clone(child, lxc.CloneOptions{Backend: backend})
 	log.Check(log.FatalLevel, "Cloning container", err)
 
-	fs.SubvolumeClone(config.Agent.LxcPrefix+parent+"/home", config.Agent.LxcPrefix+child+"/home")
-	fs.SubvolumeClone(config.Agent.LxcPrefix+parent+"/opt", config.Agent.LxcPrefix+child+"/opt")
-	fs.SubvolumeClone(config.Agent.LxcPrefix+parent+"/var", config.Agent.LxcPrefix+child+"/var")
+	fs.Selected().SubvolumeClone(config.Agent.LxcPrefix+parent+"/home", config.Agent.LxcPrefix+child+"/home")
+	fs.Selected().SubvolumeClone(config.Agent.LxcPrefix+parent+"/opt", config.Agent.LxcPrefix+child+"/opt")
+	fs.Selected().SubvolumeClone(config.Agent.LxcPrefix+parent+"/var", config.Agent.LxcPrefix+child+"/var")
 
 	SetContainerConf(child, [][]string{
 		{"lxc.network.link", ""},
@@ -246,6 +246,12 @@ func Clone(parent, child string) {
 		{"lxc.mount.entry", config.Agent.LxcPrefix + child + "/var var none bind,rw 0 0"},
 		{"lxc.network.mtu", "1300"},
 	})
+
+	if !securityOptedOut(child) {
+		log.Check(log.WarnLevel, "Applying security profile", ApplySecurityProfile(child, DefaultSecurityProfile))
+	}
+
+	log.Check(log.WarnLevel, "Preparing "+child+" for the configured runtime", SelectRuntime().Prepare(child))
 }
 
 // ResetNet sets default parameters of the network configuration for container.
@@ -272,8 +278,14 @@ func QuotaRAM(name string, size ...string) int {
 	i, err := strconv.Atoi(size[0])
 	log.Check(log.DebugLevel, "Parsing quota size", err)
 	if i > 0 {
-		log.Check(log.DebugLevel, "Setting memory limit", c.SetMemoryLimit(lxc.ByteSize(i*1024*1024)))
-		SetContainerConf(name, [][]string{{"lxc.cgroup.memory.limit_in_bytes", size[0] + "M"}})
+		cgroupItem, confKey, confValue := memoryConfigItem(int64(i) * 1024 * 1024)
+		if cgroupWritable() {
+			log.Check(log.DebugLevel, "Setting memory limit", c.SetMemoryLimit(lxc.ByteSize(i*1024*1024)))
+			if isCgroupV2() {
+				log.Check(log.DebugLevel, "Setting "+cgroupItem, c.SetCgroupItem(cgroupItem, confValue))
+			}
+		}
+		SetContainerConf(name, [][]string{{confKey, confValue}})
 	}
 	limit, err := c.MemoryLimit()
 	log.Check(log.DebugLevel, "Getting memory limit of container: "+name, err)
@@ -311,14 +323,23 @@ func QuotaCPU(name string, size ...string) int {
 	}
 
 	if size[0] != "" && State(name) == "RUNNING" {
-		value := strconv.Itoa(int(float32(cfsPeriod) * float32(runtime.NumCPU()) * quota / 100))
-		log.Check(log.DebugLevel, "Setting cpu.cfs_quota_us", c.SetCgroupItem("cpu.cfs_quota_us", value))
-
-		SetContainerConf(name, [][]string{{"lxc.cgroup.cpu.cfs_quota_us", value}})
+		quotaUs := int(float32(cfsPeriod) * float32(runtime.NumCPU()) * quota / 100)
+		cgroupItem, cgroupValue, confKey, confValue := cpuQuotaConfigItem(quotaUs, cfsPeriod)
+		if cgroupWritable() {
+			log.Check(log.DebugLevel, "Setting "+cgroupItem, c.SetCgroupItem(cgroupItem, cgroupValue))
+		}
+		SetContainerConf(name, [][]string{{confKey, confValue}})
 	}
 
-	result, err := strconv.Atoi(c.CgroupItem("cpu.cfs_quota_us")[0])
+	cgroupItem := "cpu.cfs_quota_us"
+	if isCgroupV2() {
+		cgroupItem = "cpu.max"
+	}
+	result, err := cpuQuotaFromCgroup(c.CgroupItem(cgroupItem)[0])
 	log.Check(log.DebugLevel, "Parsing quota size", err)
+	if result < 0 {
+		return -1
+	}
 	return result * 100 / cfsPeriod / runtime.NumCPU()
 }
 
@@ -327,8 +348,10 @@ func QuotaCPUset(name string, size ...string) string {
 	c, err := lxc.NewContainer(name, config.Agent.LxcPrefix)
 	log.Check(log.DebugLevel, "Looking for container: "+name, err)
 	if size[0] != "" {
-		log.Check(log.DebugLevel, "Setting cpuset.cpus", c.SetCgroupItem("cpuset.cpus", size[0]))
-		SetContainerConf(name, [][]string{{"lxc.cgroup.cpuset.cpus", size[0]}})
+		if cgroupWritable() {
+			log.Check(log.DebugLevel, "Setting cpuset.cpus", c.SetCgroupItem("cpuset.cpus", size[0]))
+		}
+		SetContainerConf(name, [][]string{{cpuSetConfigKey(), size[0]}})
 	}
 	return c.CgroupItem("cpuset.cpus")[0]
 }
@@ -396,6 +419,11 @@ func GetConfigItem(path, item string) string {
 // SetContainerUID sets UID map shifting for the Subutai container.
 // It's required option for any unprivileged LXC container.
 func SetContainerUID(c string) {
+	if config.Agent.Rootless {
+		setContainerUIDRootless(c)
+		return
+	}
+
 	uid := "65536"
 	if bolt, err := db.New(); err == nil {
 		uid = bolt.GetUuidEntry(c)
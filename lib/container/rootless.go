@@ -0,0 +1,79 @@
+package container
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/log"
+)
+
+// subIDRangeFiles maps the lxc.id_map kind LXC expects to the /etc file
+// that allocates a subordinate id range for that kind.
+var subIDRangeFiles = map[string]string{"u": "/etc/subuid", "g": "/etc/subgid"}
+
+// subIDRange returns the subordinate id range path (/etc/subuid or
+// /etc/subgid) allocates to username, as newuidmap/newgidmap and lxc.idmap
+// require in rootless mode.
+func subIDRange(kind, username string) (start, count uint32, err error) {
+	path := subIDRangeFiles[kind]
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ":")
+		if len(fields) != 3 || fields[0] != username {
+			continue
+		}
+		s, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return 0, 0, err
+		}
+		n, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return 0, 0, err
+		}
+		return uint32(s), uint32(n), nil
+	}
+	return 0, 0, errors.New(username + " has no entry in " + path)
+}
+
+// setContainerUIDRootless maps container c's user namespace from the
+// subuid/subgid ranges /etc/subuid and /etc/subgid allocate to the agent's
+// own user, instead of shifting rootfs ownership with uidmapshift as root.
+func setContainerUIDRootless(c string) {
+	me, err := user.Current()
+	if log.Check(log.WarnLevel, "Looking up current user", err) {
+		return
+	}
+
+	uidStart, uidCount, err := subIDRange("u", me.Username)
+	if log.Check(log.WarnLevel, "Reading /etc/subuid", err) {
+		return
+	}
+	gidStart, gidCount, err := subIDRange("g", me.Username)
+	if log.Check(log.WarnLevel, "Reading /etc/subgid", err) {
+		return
+	}
+
+	SetContainerConf(c, [][]string{
+		{"lxc.include", config.Agent.AppPrefix + "share/lxc/config/ubuntu.common.conf"},
+		{"lxc.include", config.Agent.AppPrefix + "share/lxc/config/ubuntu.userns.conf"},
+		{"lxc.id_map", "u 0 " + strconv.FormatUint(uint64(uidStart), 10) + " " + strconv.FormatUint(uint64(uidCount), 10)},
+		{"lxc.id_map", "g 0 " + strconv.FormatUint(uint64(gidStart), 10) + " " + strconv.FormatUint(uint64(gidCount), 10)},
+	})
+
+	// An unprivileged user can't chown foreign uids onto rootfs the way
+	// uidmapshift does as root, so rootless rootfs must already be owned
+	// by a uid/gid this mapping covers (e.g. via an idmapped mount at
+	// template-unpack time) rather than shifted here.
+	log.Info("Rootless mode: skipping rootfs uidmapshift for " + c + ", expecting a pre-shifted or idmapped rootfs")
+}
@@ -0,0 +1,44 @@
+package container
+
+import "github.com/subutai-io/agent/config"
+
+// Resources is the backend-agnostic set of quota values SetResources
+// accepts; Runtime implementations translate it into whatever their
+// backend's native knobs are (LXC cgroup keys, an OCI runtime-spec
+// linux.resources block, ...).
+type Resources struct {
+	CPUQuota         int    // cfs_quota_us equivalent, -1 for unlimited
+	CPUPeriod        int    // cfs_period_us equivalent
+	CPUSet           string // e.g. "0-3"
+	MemoryLimitBytes int64
+}
+
+// Runtime is the container execution backend contract. It lets the agent
+// manage containers through go-lxc or through an OCI-compatible runtime
+// (runc/crun) without the rest of the package caring which one is active.
+type Runtime interface {
+	Start(name string) error
+	Stop(name string) error
+	Exec(name string, command []string, env ...[]string) ([]string, error)
+	Destroy(name string) error
+	State(name string) string
+	SetResources(name string, res Resources) error
+
+	// Prepare performs whatever one-time, backend-specific setup a freshly
+	// Clone-d container needs before Start can be called on it - generating
+	// an OCI bundle's config.json for ociRuntime, a no-op for lxcRuntime
+	// since Clone already leaves go-lxc's own config in place.
+	Prepare(name string) error
+}
+
+// SelectRuntime returns the Runtime configured via config.Agent.Runtime,
+// falling back to the LXC backend when it is empty or unrecognized so
+// existing deployments keep their current behavior untouched.
+func SelectRuntime() Runtime {
+	switch config.Agent.Runtime {
+	case "oci":
+		return ociRuntime{}
+	default:
+		return lxcRuntime{}
+	}
+}
@@ -0,0 +1,77 @@
+package container
+
+import (
+	"strconv"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/log"
+
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+// lxcRuntime implements Runtime on top of the existing go-lxc backed
+// functions in this package, so hosts that don't set config.Agent.Runtime
+// keep exactly their current behavior.
+type lxcRuntime struct{}
+
+func (lxcRuntime) Start(name string) error {
+	Start(name)
+	return nil
+}
+
+func (lxcRuntime) Stop(name string) error {
+	Stop(name)
+	return nil
+}
+
+func (lxcRuntime) Exec(name string, command []string, env ...[]string) ([]string, error) {
+	return AttachExec(name, command, env...)
+}
+
+func (lxcRuntime) Destroy(name string) error {
+	Destroy(name)
+	return nil
+}
+
+func (lxcRuntime) State(name string) string {
+	return State(name)
+}
+
+// Prepare is a no-op: Clone already leaves a complete go-lxc config in
+// place for the child container, nothing further is needed before Start.
+func (lxcRuntime) Prepare(name string) error {
+	return nil
+}
+
+// SetResources translates the backend-agnostic Resources into cgroup v1
+// lxc.cgroup.* config keys and live cgroup writes. Unlike QuotaCPU/QuotaRAM/
+// QuotaCPUset, it does not switch to the lxc.cgroup2.* keys on a cgroup v2
+// host, and it makes the live cgroup writes in rootless mode as well.
+func (lxcRuntime) SetResources(name string, res Resources) error {
+	c, err := lxc.NewContainer(name, config.Agent.LxcPrefix)
+	if log.Check(log.WarnLevel, "Looking for container: "+name, err) {
+		return err
+	}
+
+	if res.MemoryLimitBytes > 0 {
+		log.Check(log.DebugLevel, "Setting memory limit", c.SetMemoryLimit(lxc.ByteSize(res.MemoryLimitBytes)))
+		SetContainerConf(name, [][]string{{"lxc.cgroup.memory.limit_in_bytes", strconv.FormatInt(res.MemoryLimitBytes, 10)}})
+	}
+
+	if res.CPUQuota > 0 {
+		period := res.CPUPeriod
+		if period == 0 {
+			period = 100000
+		}
+		value := strconv.Itoa(res.CPUQuota)
+		log.Check(log.DebugLevel, "Setting cpu.cfs_quota_us", c.SetCgroupItem("cpu.cfs_quota_us", value))
+		SetContainerConf(name, [][]string{{"lxc.cgroup.cpu.cfs_quota_us", value}})
+	}
+
+	if res.CPUSet != "" {
+		log.Check(log.DebugLevel, "Setting cpuset.cpus", c.SetCgroupItem("cpuset.cpus", res.CPUSet))
+		SetContainerConf(name, [][]string{{"lxc.cgroup.cpuset.cpus", res.CPUSet}})
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+package container
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/db"
+	"github.com/subutai-io/agent/log"
+)
+
+// ociSpec is a minimal subset of the OCI runtime-spec config.json, enough
+// to start a Subutai container's existing btrfs rootfs under runc/crun.
+type ociSpec struct {
+	OCIVersion string      `json:"ociVersion"`
+	Root       ociRoot     `json:"root"`
+	Process    ociProcess  `json:"process"`
+	Linux      ociLinux    `json:"linux"`
+}
+
+type ociRoot struct {
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly"`
+}
+
+type ociProcess struct {
+	Terminal bool     `json:"terminal"`
+	Args     []string `json:"args"`
+	Cwd      string   `json:"cwd"`
+}
+
+type ociLinux struct {
+	Namespaces  []ociNamespace `json:"namespaces"`
+	UIDMappings []ociIDMapping `json:"uidMappings,omitempty"`
+	GIDMappings []ociIDMapping `json:"gidMappings,omitempty"`
+	Resources   ociResources   `json:"resources"`
+}
+
+// ociNamespace mirrors one entry of the runtime-spec's linux.namespaces
+// array; it carries no path, so runc creates a fresh namespace of Type
+// rather than joining an existing one.
+type ociNamespace struct {
+	Type string `json:"type"`
+}
+
+// baseNamespaces are the namespaces every OCI container gets regardless of
+// whether it's running with a shifted uid/gid mapping; "user" is added on
+// top of these only when UIDMappings/GIDMappings are set, since runc
+// refuses to start a container that declares ID mappings without also
+// declaring a user namespace.
+var baseNamespaces = []ociNamespace{
+	{Type: "pid"},
+	{Type: "mount"},
+	{Type: "uts"},
+	{Type: "ipc"},
+	{Type: "network"},
+}
+
+// ociIDMapping mirrors the uid/gid shift SetContainerUID writes into
+// lxc.id_map for unprivileged LXC containers, translated into the
+// runtime-spec's user namespace mapping.
+type ociIDMapping struct {
+	ContainerID uint32 `json:"containerID"`
+	HostID      uint32 `json:"hostID"`
+	Size        uint32 `json:"size"`
+}
+
+type ociResources struct {
+	CPU    *ociCPU    `json:"cpu,omitempty"`
+	Memory *ociMemory `json:"memory,omitempty"`
+}
+
+type ociCPU struct {
+	Quota  int64  `json:"quota,omitempty"`
+	Period uint64 `json:"period,omitempty"`
+	Cpus   string `json:"cpus,omitempty"`
+}
+
+type ociMemory struct {
+	Limit int64 `json:"limit,omitempty"`
+}
+
+// ociRuntime implements Runtime by shelling out to runc/crun against an
+// runtime-spec bundle generated from the container's btrfs subvolume.
+type ociRuntime struct{}
+
+func bundlePath(name string) string {
+	return config.Agent.LxcPrefix + name
+}
+
+// generateBundle writes a minimal OCI runtime-spec config.json for name,
+// rooted at the container's existing btrfs "rootfs" subvolume, so Start has
+// an actual bundle to hand to runc. It leaves an already-generated bundle
+// alone so a config.json an operator hand-edited survives a later Start.
+// The uid/gid mapping mirrors the shift SetContainerUID applies for the LXC
+// backend, read from the same uuid database entry.
+func generateBundle(name string) error {
+	specPath := bundlePath(name) + "/config.json"
+	if _, err := os.Stat(specPath); err == nil {
+		return nil
+	}
+
+	spec := ociSpec{
+		OCIVersion: "1.0.2",
+		Root:       ociRoot{Path: "rootfs", Readonly: false},
+		Process:    ociProcess{Terminal: false, Args: []string{"/sbin/init"}, Cwd: "/"},
+	}
+	spec.Linux.Namespaces = append([]ociNamespace(nil), baseNamespaces...)
+
+	if !config.Agent.Rootless {
+		uid := uint64(65536)
+		if bolt, err := db.New(); err == nil {
+			if parsed, err := strconv.ParseUint(bolt.GetUuidEntry(name), 10, 32); err == nil {
+				uid = parsed
+			}
+			log.Check(log.WarnLevel, "Closing database", bolt.Close())
+		}
+		mapping := []ociIDMapping{{ContainerID: 0, HostID: uint32(uid), Size: 65536}}
+		spec.Linux.UIDMappings = mapping
+		spec.Linux.GIDMappings = mapping
+		spec.Linux.Namespaces = append(spec.Linux.Namespaces, ociNamespace{Type: "user"})
+	}
+
+	out, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(specPath, out, 0644)
+}
+
+// Prepare generates the bundle a freshly cloned container needs before it
+// can be started under this runtime.
+func (ociRuntime) Prepare(name string) error {
+	return generateBundle(name)
+}
+
+func (ociRuntime) Start(name string) error {
+	bundle := bundlePath(name)
+	if err := generateBundle(name); err != nil {
+		return err
+	}
+	out, err := exec.Command("runc", "run", "-d", "-b", bundle, name).CombinedOutput()
+	log.Check(log.DebugLevel, "Starting OCI container "+name+": "+string(out), err)
+	return err
+}
+
+func (ociRuntime) Stop(name string) error {
+	out, err := exec.Command("runc", "kill", name, "SIGTERM").CombinedOutput()
+	log.Check(log.DebugLevel, "Stopping OCI container "+name+": "+string(out), err)
+	return err
+}
+
+func (ociRuntime) Exec(name string, command []string, env ...[]string) (output []string, err error) {
+	args := append([]string{"exec", name}, command...)
+	out, err := exec.Command("runc", args...).CombinedOutput()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(strings.TrimRight(string(out), "\n"), "\n"), nil
+}
+
+func (ociRuntime) Destroy(name string) error {
+	out, err := exec.Command("runc", "delete", "-f", name).CombinedOutput()
+	log.Check(log.DebugLevel, "Destroying OCI container "+name+": "+string(out), err)
+	return err
+}
+
+func (ociRuntime) State(name string) string {
+	out, err := exec.Command("runc", "state", name).Output()
+	if log.Check(log.DebugLevel, "Getting OCI container state: "+name, err) {
+		return "UNKNOWN"
+	}
+	var state struct {
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(out, &state); err != nil {
+		return "UNKNOWN"
+	}
+	return strings.ToUpper(state.Status)
+}
+
+// SetResources rewrites the bundle's config.json linux.resources block with
+// the cpu.quota/period, cpuset.cpus and memory.limit equivalents of res,
+// mirroring the semantics QuotaCPU/QuotaRAM/QuotaCPUset apply on the LXC
+// backend.
+func (ociRuntime) SetResources(name string, res Resources) error {
+	specPath := bundlePath(name) + "/config.json"
+	data, err := ioutil.ReadFile(specPath)
+	if err != nil {
+		return err
+	}
+
+	var spec ociSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return err
+	}
+
+	if res.MemoryLimitBytes > 0 {
+		spec.Linux.Resources.Memory = &ociMemory{Limit: res.MemoryLimitBytes}
+	}
+	if res.CPUQuota > 0 {
+		period := uint64(res.CPUPeriod)
+		if period == 0 {
+			period = 100000
+		}
+		spec.Linux.Resources.CPU = &ociCPU{Quota: int64(res.CPUQuota), Period: period, Cpus: res.CPUSet}
+	} else if res.CPUSet != "" {
+		if spec.Linux.Resources.CPU == nil {
+			spec.Linux.Resources.CPU = &ociCPU{}
+		}
+		spec.Linux.Resources.CPU.Cpus = res.CPUSet
+	}
+
+	if spec.OCIVersion == "" {
+		return errors.New("config.json for " + name + " is not a valid OCI bundle")
+	}
+
+	out, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(specPath, out, 0644)
+}
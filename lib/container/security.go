@@ -0,0 +1,90 @@
+package container
+
+import (
+	"strings"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/db"
+	"github.com/subutai-io/agent/log"
+)
+
+// SecurityProfile describes the hardening applied to a freshly cloned
+// container: masked/read-only kernel-info paths, dropped capabilities and
+// an optional seccomp/AppArmor policy.
+type SecurityProfile struct {
+	// Privileged containers skip every restriction below.
+	Privileged bool
+	// MaskedPaths are bind-mounted over with /dev/null so the container
+	// can't read them at all.
+	MaskedPaths []string
+	// ReadOnlyPaths are bind-mounted read-only in place.
+	ReadOnlyPaths []string
+	// DropCaps are Linux capability names (without the CAP_ prefix, to
+	// match lxc.cap.drop's own convention) removed from the container.
+	DropCaps []string
+	// SeccompProfile is a path to a compiled seccomp allowlist, or empty
+	// to skip loading one.
+	SeccompProfile string
+	// AppArmorProfile is the lxc.aa_profile value, or empty to use the
+	// host's default.
+	AppArmorProfile string
+}
+
+// DefaultSecurityProfile masks the paths LXC/Docker hardening guides flag
+// as kernel information disclosure risks and drops the capabilities a
+// container has no legitimate use for unless it's explicitly privileged.
+var DefaultSecurityProfile = SecurityProfile{
+	MaskedPaths: []string{
+		"proc/kcore", "proc/latency_stats", "proc/timer_list",
+		"proc/timer_stats", "proc/sched_debug", "proc/scsi", "sys/firmware",
+	},
+	ReadOnlyPaths: []string{
+		"proc/asound", "proc/bus", "proc/fs", "proc/irq", "proc/sys", "proc/sysrq-trigger",
+	},
+	DropCaps:       []string{"SYS_ADMIN", "NET_ADMIN", "SYS_MODULE", "SYS_TIME"},
+	SeccompProfile: config.Agent.AppPrefix + "share/subutai/seccomp/default.json",
+}
+
+// securityOptOutKey is the bolt DB container-metadata key that, when set to
+// "true", makes Clone skip ApplySecurityProfile for that container.
+const securityOptOutKey = "security.profile.disabled"
+
+// ApplySecurityProfile writes the lxc.cap.drop/lxc.seccomp/lxc.aa_profile
+// keys and masking bind-mounts for profile into name's container config.
+func ApplySecurityProfile(name string, profile SecurityProfile) error {
+	if profile.Privileged {
+		return nil
+	}
+
+	var conf [][]string
+	for _, c := range profile.DropCaps {
+		conf = append(conf, []string{"lxc.cap.drop", c})
+	}
+	if profile.SeccompProfile != "" {
+		conf = append(conf, []string{"lxc.seccomp", profile.SeccompProfile})
+	}
+	if profile.AppArmorProfile != "" {
+		conf = append(conf, []string{"lxc.aa_profile", profile.AppArmorProfile})
+	}
+	for _, p := range profile.MaskedPaths {
+		conf = append(conf, []string{"lxc.mount.entry", "/dev/null " + strings.TrimSuffix(p, "/") + " none bind,ro,optional 0 0"})
+	}
+	for _, p := range profile.ReadOnlyPaths {
+		clean := strings.TrimSuffix(p, "/")
+		conf = append(conf, []string{"lxc.mount.entry", clean + " " + clean + " none bind,ro,optional 0 0"})
+	}
+
+	SetContainerConf(name, conf)
+	return nil
+}
+
+// securityOptedOut reports whether name's container metadata disables
+// automatic security profile application.
+func securityOptedOut(name string) bool {
+	bolt, err := db.New()
+	if log.Check(log.WarnLevel, "Opening database", err) {
+		return false
+	}
+	defer bolt.Close()
+	return bolt.ContainerMeta(name, securityOptOutKey) == "true"
+}
@@ -0,0 +1,233 @@
+package container
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/log"
+
+	"gopkg.in/lxc/go-lxc.v2"
+)
+
+// CPUStats is cumulative CPU time consumed by a container, in nanoseconds.
+type CPUStats struct {
+	UserNs, SystemNs, TotalNs uint64
+}
+
+// MemoryStats is the container's current and configured memory usage.
+type MemoryStats struct {
+	UsageBytes, LimitBytes uint64
+}
+
+// BlkIOStats is per-device block I/O counters.
+type BlkIOStats struct {
+	Device                                    string
+	ReadBytes, WriteBytes, ReadOps, WriteOps uint64
+}
+
+// NetStats is cumulative network traffic for the container's netns.
+type NetStats struct {
+	RxBytes, TxBytes uint64
+}
+
+// ContainerStats is a single point-in-time snapshot of a container's
+// resource usage, gathered directly from cgroups and /proc instead of
+// reopening the container once per metric like the quota getters do.
+type ContainerStats struct {
+	CPU    CPUStats
+	Memory MemoryStats
+	BlkIO  []BlkIOStats
+	Net    NetStats
+}
+
+// Stats returns a snapshot of name's current resource usage.
+func Stats(name string) (*ContainerStats, error) {
+	c, err := lxc.NewContainer(name, config.Agent.LxcPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ContainerStats{
+		CPU:    cpuStats(c),
+		Memory: memoryStats(c),
+		BlkIO:  blkioStats(c),
+	}
+
+	if pid := c.InitPid(); pid > 0 {
+		stats.Net = netStats(pid)
+	}
+
+	return stats, nil
+}
+
+// StatsStream emits a ContainerStats snapshot on the returned channel every
+// interval until the container is destroyed or the process exits; the
+// channel is closed when sampling stops being possible.
+func StatsStream(name string, interval time.Duration) <-chan ContainerStats {
+	out := make(chan ContainerStats)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			stats, err := Stats(name)
+			if err != nil {
+				return
+			}
+			out <- *stats
+		}
+	}()
+	return out
+}
+
+func cpuStats(c *lxc.Container) CPUStats {
+	if isCgroupV2() {
+		data := cgroupItemLines(c, "cpu.stat")
+		values := map[string]uint64{}
+		for _, line := range data {
+			f := strings.Fields(line)
+			if len(f) == 2 {
+				v, _ := strconv.ParseUint(f[1], 10, 64)
+				values[f[0]] = v
+			}
+		}
+		total := values["usage_usec"] * 1000
+		return CPUStats{UserNs: values["user_usec"] * 1000, SystemNs: values["system_usec"] * 1000, TotalNs: total}
+	}
+
+	usage := cgroupUint(c, "cpuacct.usage")
+	stat := map[string]uint64{}
+	for _, line := range cgroupItemLines(c, "cpuacct.stat") {
+		f := strings.Fields(line)
+		if len(f) == 2 {
+			v, _ := strconv.ParseUint(f[1], 10, 64)
+			stat[f[0]] = v
+		}
+	}
+	return CPUStats{UserNs: stat["user"] * 1e7, SystemNs: stat["system"] * 1e7, TotalNs: usage}
+}
+
+func memoryStats(c *lxc.Container) MemoryStats {
+	if isCgroupV2() {
+		return MemoryStats{UsageBytes: cgroupUint(c, "memory.current"), LimitBytes: cgroupUint(c, "memory.max")}
+	}
+	return MemoryStats{UsageBytes: cgroupUint(c, "memory.usage_in_bytes"), LimitBytes: cgroupUint(c, "memory.limit_in_bytes")}
+}
+
+func blkioStats(c *lxc.Container) []BlkIOStats {
+	item := "blkio.throttle.io_service_bytes"
+	if isCgroupV2() {
+		item = "io.stat"
+	}
+
+	byDevice := map[string]*BlkIOStats{}
+	get := func(device string) *BlkIOStats {
+		if s, ok := byDevice[device]; ok {
+			return s
+		}
+		s := &BlkIOStats{Device: device}
+		byDevice[device] = s
+		return s
+	}
+
+	for _, line := range cgroupItemLines(c, item) {
+		f := strings.Fields(line)
+		if len(f) < 2 {
+			continue
+		}
+		if isCgroupV2() {
+			s := get(f[0])
+			for _, kv := range f[1:] {
+				parts := strings.SplitN(kv, "=", 2)
+				if len(parts) != 2 {
+					continue
+				}
+				v, _ := strconv.ParseUint(parts[1], 10, 64)
+				switch parts[0] {
+				case "rbytes":
+					s.ReadBytes = v
+				case "wbytes":
+					s.WriteBytes = v
+				case "rios":
+					s.ReadOps = v
+				case "wios":
+					s.WriteOps = v
+				}
+			}
+			continue
+		}
+		if len(f) < 3 {
+			continue
+		}
+		s := get(f[0])
+		v, _ := strconv.ParseUint(f[2], 10, 64)
+		switch f[1] {
+		case "Read":
+			s.ReadBytes = v
+		case "Write":
+			s.WriteBytes = v
+		}
+	}
+
+	result := make([]BlkIOStats, 0, len(byDevice))
+	for _, s := range byDevice {
+		result = append(result, *s)
+	}
+	return result
+}
+
+// netStats parses /proc/<pid>/net/dev for the container's network
+// namespace, summing every interface except loopback.
+func netStats(pid int) NetStats {
+	var stats NetStats
+	file, err := os.Open("/proc/" + strconv.Itoa(pid) + "/net/dev")
+	if log.Check(log.DebugLevel, "Opening /proc/<pid>/net/dev", err) {
+		return stats
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.Contains(line, ":") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		iface := strings.TrimSpace(parts[0])
+		if iface == "lo" {
+			continue
+		}
+		fields := strings.Fields(parts[1])
+		if len(fields) < 9 {
+			continue
+		}
+		rx, _ := strconv.ParseUint(fields[0], 10, 64)
+		tx, _ := strconv.ParseUint(fields[8], 10, 64)
+		stats.RxBytes += rx
+		stats.TxBytes += tx
+	}
+	return stats
+}
+
+func cgroupItemLines(c *lxc.Container, item string) []string {
+	values := c.CgroupItem(item)
+	var lines []string
+	for _, v := range values {
+		lines = append(lines, strings.Split(v, "\n")...)
+	}
+	return lines
+}
+
+func cgroupUint(c *lxc.Container, item string) uint64 {
+	values := c.CgroupItem(item)
+	if len(values) == 0 {
+		return 0
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(values[0]), 10, 64)
+	log.Check(log.DebugLevel, "Parsing cgroup item "+item, err)
+	return v
+}
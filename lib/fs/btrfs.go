@@ -4,11 +4,11 @@ package fs
 import (
 	"bufio"
 	"bytes"
-	"io/ioutil"
 	"os"
 	"os/exec"
-	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/subutai-io/agent/config"
 	"github.com/subutai-io/agent/log"
@@ -16,31 +16,26 @@ import (
 
 // IsSubvolumeReadonly checks if BTRFS subvolume have "readonly" property.
 // It's used in Subutai to check if LXC container template or not.
+// The actual check is build-tag dispatched: isSubvolumeReadonly shells out
+// to btrfs(8) by default, or uses BTRFS_IOC_SUBVOL_GETFLAGS directly when
+// built with the btrfs_ioctl tag.
 func IsSubvolumeReadonly(path string) bool {
-	out, err := exec.Command("btrfs", "property", "get", "-ts", path).Output()
-	log.Check(log.DebugLevel, "Getting BTRFS subvolume readonly property", err)
-	return strings.Contains(string(out), "true")
+	return isSubvolumeReadonly(path)
 }
 
 // IsSubvolume checks if path BTRFS subvolume.
 func IsSubvolume(path string) bool {
-	out, err := exec.Command("btrfs", "subvolume", "show", path).CombinedOutput()
-	log.Check(log.DebugLevel, "Checking is path BTRFS subvolume", err)
-	return strings.Contains(string(out), "Subvolume ID")
+	return isSubvolume(path)
 }
 
 // SubvolumeCreate creates BTRFS subvolume.
 func SubvolumeCreate(dst string) {
-	if id(dst) == "" {
-		out, err := exec.Command("btrfs", "subvolume", "create", dst).CombinedOutput()
-		log.Check(log.FatalLevel, "Creating subvolume "+dst+": "+string(out), err)
-	}
+	subvolumeCreate(dst)
 }
 
 // SubvolumeClone creates snapshot of the BTRFS subvolume.
 func SubvolumeClone(src, dst string) {
-	out, err := exec.Command("btrfs", "subvolume", "snapshot", src, dst).CombinedOutput()
-	log.Check(log.FatalLevel, "Creating snapshot: "+string(out), err)
+	subvolumeClone(src, dst)
 }
 
 // SubvolumeDestroy deletes BTRFS subvolume and all subdirectories.
@@ -61,8 +56,7 @@ func SubvolumeDestroy(path string) {
 			}
 		}
 		qgroupDestroy(v)
-		out, err := exec.Command("btrfs", "subvolume", "delete", v).CombinedOutput()
-		log.Check(log.DebugLevel, "Destroying subvolume "+v+": "+string(out), err)
+		subvolumeDelete(v)
 	}
 	log.Check(log.DebugLevel, "Removing path "+path, exec.Command("rm", "-rf", path).Run())
 }
@@ -74,64 +68,87 @@ func qgroupDestroy(path string) {
 	log.Check(log.DebugLevel, "Destroying qgroup "+path+" "+index+": "+string(out), err)
 }
 
-// NEED REFACTORING
+// idCacheTTL bounds how stale idCacheLines can get between the explicit
+// invalidateIDCache calls subvolumeCreate/subvolumeDelete already make -
+// it exists only to cover id changes made by something other than this
+// process (another agent, an operator running btrfs(8) by hand).
+const idCacheTTL = 5 * time.Second
+
+var (
+	idCacheMu    sync.Mutex
+	idCacheLines [][]string
+	idCacheAt    time.Time
+)
+
+// id resolves path to the btrfs subvolume id "btrfs qgroup"/"btrfs
+// subvolume" commands key their output on. DiskQuota, Stat, qgroupDestroy
+// and subvolumeCreate all call it, and a full "btrfs subvolume list" shell-
+// out dominates their cost once a Resource Host hosts more than a handful
+// of containers, so the parsed listing is cached instead of re-forked on
+// every lookup.
 func id(path string) string {
 	path = strings.Replace(path, config.Agent.LxcPrefix, "", -1)
+
+	idCacheMu.Lock()
+	if idCacheLines == nil || time.Since(idCacheAt) > idCacheTTL {
+		idCacheLines = listSubvolumes()
+		idCacheAt = time.Now()
+	}
+	lines := idCacheLines
+	idCacheMu.Unlock()
+
+	for _, line := range lines {
+		if len(line) > 8 && strings.HasSuffix(line[8], path) {
+			return line[1]
+		}
+	}
+	return ""
+}
+
+func listSubvolumes() [][]string {
 	out, err := exec.Command("btrfs", "subvolume", "list", config.Agent.LxcPrefix).Output()
 	log.Check(log.DebugLevel, "Getting BTRFS subvolume list", err)
+
+	var lines [][]string
 	scanner := bufio.NewScanner(bytes.NewReader(out))
 	for scanner.Scan() {
-		line := strings.Fields(scanner.Text())
-		if len(line) > 8 {
-			if strings.HasSuffix(line[8], path) {
-				return line[1]
-			}
-		}
+		lines = append(lines, strings.Fields(scanner.Text()))
 	}
-	return ""
+	return lines
+}
+
+// invalidateIDCache drops the cached subvolume listing id reads from, so
+// the next lookup re-lists rather than risk returning a stale answer for a
+// subvolume this process just created or destroyed.
+func invalidateIDCache() {
+	idCacheMu.Lock()
+	idCacheLines = nil
+	idCacheMu.Unlock()
 }
 
 // Receive creates BTRFS subvolume using saved delta-file, it can depend on some parent.
 // Parent subvolume should be installed before receiving child subvolume.
+// It's a thin wrapper over ReceiveStream for callers still passing a
+// tmpdir/ delta file around instead of streaming directly.
 func Receive(src, dst, delta string, parent bool) {
-	args := []string{"receive", "-p", src, dst}
-	if !parent {
-		args = []string{"receive", dst}
-	}
-	log.Debug(strings.Join(args, " "))
-	receive := exec.Command("btrfs", args...)
 	input, err := os.Open(config.Agent.LxcPrefix + "tmpdir/" + delta)
-	if !log.Check(log.FatalLevel, "Opening delta "+delta, err) {
-		defer input.Close()
-		receive.Stdin = input
-		out, err := receive.CombinedOutput()
-		log.Check(log.FatalLevel, "Receiving delta "+delta+": "+string(out), err)
+	if log.Check(log.FatalLevel, "Opening delta "+delta, err) {
+		return
 	}
+	defer input.Close()
+	log.Check(log.FatalLevel, "Receiving delta "+delta, ReceiveStream(src, dst, input, parent))
 }
 
 // Send creates delta-file using BTRFS subvolume, it can depend on some parent.
+// It's a thin wrapper over SendStream for callers still passing a tmpdir/
+// delta file around instead of streaming directly.
 func Send(src, dst, delta string) error {
-	tmpDir, err := ioutil.TempDir(config.Agent.LxcPrefix+"tmpdir/", "export")
+	out, err := os.Create(config.Agent.LxcPrefix + "tmpdir/" + delta)
 	if err != nil {
 		return err
 	}
-	defer os.RemoveAll(tmpDir)
-
-	if path := strings.Split(dst, "/"); len(path) > 0 {
-		tmpVolume := tmpDir + "/" + path[len(path)-1]
-
-		SubvolumeClone(dst, tmpVolume)
-		defer SubvolumeDestroy(tmpVolume)
-		SetVolReadOnly(tmpVolume, true)
-
-		if src != dst {
-			err = exec.Command("btrfs", "send", "-p", src, tmpVolume, "-f", delta).Run()
-		} else {
-			err = exec.Command("btrfs", "send", tmpVolume, "-f", delta).Run()
-		}
-		return err
-	}
-	return nil
+	defer out.Close()
+	return SendStream(src, dst, out)
 }
 
 // ReadOnly sets readonly flag for Subutai container.
@@ -144,9 +161,7 @@ func ReadOnly(container string, flag bool) {
 
 // SetVolReadOnly sets readonly flag for BTRFS subvolume.
 func SetVolReadOnly(subvol string, flag bool) {
-	arg := []string{"property", "set", "-ts", subvol, "ro", strconv.FormatBool(flag)}
-	out, err := exec.Command("btrfs", arg...).CombinedOutput()
-	log.Check(log.FatalLevel, "Setting readonly: "+strconv.FormatBool(flag)+": "+string(out), err)
+	setVolReadOnly(subvol, flag)
 }
 
 // Stat returns quota and usage for BTRFS subvolume.
@@ -175,12 +190,8 @@ func Stat(path, index string, raw bool) (value string) {
 // DiskQuota returns total disk quota for Subutai container.
 // If size argument is set, it sets new quota value.
 func DiskQuota(path string, size ...string) string {
+	reconcileContainerQgroups(path)
 	parent := id(path)
-	exec.Command("btrfs", "qgroup", "create", "1/"+parent, config.Agent.LxcPrefix+path).Run()
-	exec.Command("btrfs", "qgroup", "assign", "0/"+id(path+"/opt"), "1/"+parent, config.Agent.LxcPrefix+path).Run()
-	exec.Command("btrfs", "qgroup", "assign", "0/"+id(path+"/var"), "1/"+parent, config.Agent.LxcPrefix+path).Run()
-	exec.Command("btrfs", "qgroup", "assign", "0/"+id(path+"/home"), "1/"+parent, config.Agent.LxcPrefix+path).Run()
-	exec.Command("btrfs", "qgroup", "assign", "0/"+id(path+"/rootfs"), "1/"+parent, config.Agent.LxcPrefix+path).Run()
 
 	if size != nil {
 		if out, err := exec.Command("btrfs", "qgroup", "limit", "-e", size[0]+"G", "1/"+parent, config.Agent.LxcPrefix+path).CombinedOutput(); err != nil {
@@ -201,6 +212,21 @@ func Quota(path string, size ...string) string {
 	return Stat(path, "quota", false)
 }
 
+// btrfsDriver implements StorageDriver over the free functions above,
+// which remain the package's default, backwards-compatible API.
+type btrfsDriver struct{}
+
+func (btrfsDriver) SubvolumeCreate(dst string)              { SubvolumeCreate(dst) }
+func (btrfsDriver) SubvolumeClone(src, dst string)          { SubvolumeClone(src, dst) }
+func (btrfsDriver) SubvolumeDestroy(path string)            { SubvolumeDestroy(path) }
+func (btrfsDriver) Send(src, dst, delta string) error       { return Send(src, dst, delta) }
+func (btrfsDriver) Receive(src, dst, delta string, parent bool) { Receive(src, dst, delta, parent) }
+func (btrfsDriver) SetReadOnly(subvol string, flag bool)    { SetVolReadOnly(subvol, flag) }
+func (btrfsDriver) Quota(path string, size ...string) string { return Quota(path, size...) }
+func (btrfsDriver) DiskQuota(path string, size ...string) string {
+	return DiskQuota(path, size...)
+}
+
 // GetBtrfsRoot returns BTRFS root
 func GetBtrfsRoot() string {
 	data, err := exec.Command("findmnt", "-nT", config.Agent.LxcPrefix).Output()
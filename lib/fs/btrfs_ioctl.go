@@ -0,0 +1,173 @@
+// +build btrfs_ioctl,linux
+
+package fs
+
+import (
+	"os"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/subutai-io/agent/log"
+)
+
+// This file backs IsSubvolume/IsSubvolumeReadonly/SubvolumeCreate/
+// SubvolumeClone/subvolumeDelete/setVolReadOnly with direct calls into the
+// btrfs kernel ioctls instead of forking btrfs(8) for every operation,
+// mirroring the approach Docker's btrfs graphdriver uses. Build with
+// -tags btrfs_ioctl on a host with current kernel headers; btrfs_shell.go
+// is the default, shell-based fallback.
+
+const (
+	btrfsIoctlMagic     = 0x94
+	btrfsPathNameMax    = 4087
+	btrfsSubvolNameMax  = 4039
+	btrfsSubvolRdonly   = 1 << 1
+	btrfsFirstFreeObjID = 256
+)
+
+// btrfsIoctlVolArgs mirrors struct btrfs_ioctl_vol_args from linux/btrfs.h,
+// used by BTRFS_IOC_SNAP_DESTROY.
+type btrfsIoctlVolArgs struct {
+	fd   int64
+	name [btrfsPathNameMax + 1]byte
+}
+
+// btrfsIoctlVolArgsV2 mirrors struct btrfs_ioctl_vol_args_v2, used by
+// BTRFS_IOC_SUBVOL_CREATE_V2/BTRFS_IOC_SNAP_CREATE_V2. The qgroup-inherit
+// union member is left zeroed; we don't pass inherited qgroups.
+type btrfsIoctlVolArgsV2 struct {
+	fd      int64
+	transID uint64
+	flags   uint64
+	unused  [4]uint64
+	name    [btrfsSubvolNameMax + 1]byte
+}
+
+func iocW(nr, size uintptr) uintptr { return ioc(1, nr, size) }
+func iocR(nr, size uintptr) uintptr { return ioc(2, nr, size) }
+
+// ioc replicates the Linux _IOC(dir, type, nr, size) macro for the btrfs
+// ioctl magic number.
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | btrfsIoctlMagic<<8 | nr | size<<16
+}
+
+var (
+	btrfsIocSnapCreateV2   = iocW(23, unsafe.Sizeof(btrfsIoctlVolArgsV2{}))
+	btrfsIocSubvolCreateV2 = iocW(24, unsafe.Sizeof(btrfsIoctlVolArgsV2{}))
+	btrfsIocSnapDestroy    = iocW(15, unsafe.Sizeof(btrfsIoctlVolArgs{}))
+	btrfsIocSubvolGetflags = iocR(25, 8)
+	btrfsIocSubvolSetflags = iocW(26, 8)
+)
+
+func withDirFd(path string, fn func(fd int) error) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return fn(int(dir.Fd()))
+}
+
+func setName(buf []byte, name string) {
+	copy(buf, name)
+}
+
+func subvolumeCreate(dst string) {
+	if id(dst) != "" {
+		return
+	}
+	parent, name := splitPath(dst)
+	err := withDirFd(parent, func(fd int) error {
+		var args btrfsIoctlVolArgsV2
+		setName(args.name[:], name)
+		return ioctl(fd, btrfsIocSubvolCreateV2, unsafe.Pointer(&args))
+	})
+	log.Check(log.FatalLevel, "Creating subvolume "+dst, err)
+	invalidateIDCache()
+}
+
+func subvolumeClone(src, dst string) {
+	parent, name := splitPath(dst)
+	err := withDirFd(src, func(srcFd int) error {
+		return withDirFd(parent, func(dstFd int) error {
+			var args btrfsIoctlVolArgsV2
+			args.fd = int64(srcFd)
+			setName(args.name[:], name)
+			return ioctl(dstFd, btrfsIocSnapCreateV2, unsafe.Pointer(&args))
+		})
+	})
+	log.Check(log.FatalLevel, "Creating snapshot "+src+" -> "+dst, err)
+	invalidateIDCache()
+}
+
+func subvolumeDelete(path string) {
+	parent, name := splitPath(path)
+	err := withDirFd(parent, func(fd int) error {
+		var args btrfsIoctlVolArgs
+		setName(args.name[:], name)
+		return ioctl(fd, btrfsIocSnapDestroy, unsafe.Pointer(&args))
+	})
+	log.Check(log.DebugLevel, "Destroying subvolume "+path, err)
+	invalidateIDCache()
+}
+
+func setVolReadOnly(subvol string, flag bool) {
+	err := withDirFd(subvol, func(fd int) error {
+		var flags uint64
+		if err := ioctl(fd, btrfsIocSubvolGetflags, unsafe.Pointer(&flags)); err != nil {
+			return err
+		}
+		if flag {
+			flags |= btrfsSubvolRdonly
+		} else {
+			flags &^= btrfsSubvolRdonly
+		}
+		return ioctl(fd, btrfsIocSubvolSetflags, unsafe.Pointer(&flags))
+	})
+	log.Check(log.FatalLevel, "Setting readonly on "+subvol, err)
+}
+
+func isSubvolumeReadonly(path string) bool {
+	var flags uint64
+	err := withDirFd(path, func(fd int) error {
+		return ioctl(fd, btrfsIocSubvolGetflags, unsafe.Pointer(&flags))
+	})
+	log.Check(log.DebugLevel, "Getting BTRFS subvolume readonly property", err)
+	return flags&btrfsSubvolRdonly != 0
+}
+
+// isSubvolume reports whether path is a btrfs subvolume root by checking
+// its inode number; every subvolume root's st_ino is the well-known
+// BTRFS_FIRST_FREE_OBJECTID, which ordinary directories never have.
+func isSubvolume(path string) bool {
+	var st unix.Stat_t
+	if err := unix.Lstat(path, &st); err != nil {
+		log.Check(log.DebugLevel, "Checking is path BTRFS subvolume", err)
+		return false
+	}
+	return st.Ino == btrfsFirstFreeObjID
+}
+
+// ioctl issues a btrfs ioctl on fd with argp pointing at the request
+// struct, translating the raw errno into a Go error.
+func ioctl(fd int, req uintptr, argp unsafe.Pointer) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, uintptr(fd), req, uintptr(argp))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// splitPath splits path into its parent directory (opened to get the fd
+// the *_V2 ioctls operate relative to) and its final path component.
+func splitPath(path string) (dir, name string) {
+	path = strings.TrimSuffix(path, "/")
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return ".", path
+	}
+	return path[:i], path[i+1:]
+}
@@ -0,0 +1,54 @@
+// +build !btrfs_ioctl
+
+package fs
+
+import (
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/subutai-io/agent/log"
+)
+
+// This file backs IsSubvolume/IsSubvolumeReadonly/SubvolumeCreate/
+// SubvolumeClone/subvolumeDelete/setVolReadOnly with the original
+// btrfs(8) shell-outs. Build with -tags btrfs_ioctl to use the native
+// ioctl implementation in btrfs_ioctl.go instead.
+
+func isSubvolumeReadonly(path string) bool {
+	out, err := exec.Command("btrfs", "property", "get", "-ts", path).Output()
+	log.Check(log.DebugLevel, "Getting BTRFS subvolume readonly property", err)
+	return strings.Contains(string(out), "true")
+}
+
+func isSubvolume(path string) bool {
+	out, err := exec.Command("btrfs", "subvolume", "show", path).CombinedOutput()
+	log.Check(log.DebugLevel, "Checking is path BTRFS subvolume", err)
+	return strings.Contains(string(out), "Subvolume ID")
+}
+
+func subvolumeCreate(dst string) {
+	if id(dst) == "" {
+		out, err := exec.Command("btrfs", "subvolume", "create", dst).CombinedOutput()
+		log.Check(log.FatalLevel, "Creating subvolume "+dst+": "+string(out), err)
+		invalidateIDCache()
+	}
+}
+
+func subvolumeClone(src, dst string) {
+	out, err := exec.Command("btrfs", "subvolume", "snapshot", src, dst).CombinedOutput()
+	log.Check(log.FatalLevel, "Creating snapshot: "+string(out), err)
+	invalidateIDCache()
+}
+
+func subvolumeDelete(path string) {
+	out, err := exec.Command("btrfs", "subvolume", "delete", path).CombinedOutput()
+	log.Check(log.DebugLevel, "Destroying subvolume "+path+": "+string(out), err)
+	invalidateIDCache()
+}
+
+func setVolReadOnly(subvol string, flag bool) {
+	arg := []string{"property", "set", "-ts", subvol, "ro", strconv.FormatBool(flag)}
+	out, err := exec.Command("btrfs", arg...).CombinedOutput()
+	log.Check(log.FatalLevel, "Setting readonly: "+strconv.FormatBool(flag)+": "+string(out), err)
+}
@@ -0,0 +1,59 @@
+package fs
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/log"
+)
+
+// dirDriver implements StorageDriver over plain directories, for hosts
+// without btrfs or zfs. Cloning and send/receive go through rsync/tar
+// instead of snapshots, and quotas are a no-op unless xfs_quota project
+// quotas are set up on the host out of band.
+type dirDriver struct{}
+
+func (dirDriver) SubvolumeCreate(dst string) {
+	log.Check(log.FatalLevel, "Creating directory "+dst, os.MkdirAll(dst, 0755))
+}
+
+func (dirDriver) SubvolumeClone(src, dst string) {
+	log.Check(log.FatalLevel, "Creating directory "+dst, os.MkdirAll(dst, 0755))
+	out, err := exec.Command("rsync", "-a", strings.TrimSuffix(src, "/")+"/", dst+"/").CombinedOutput()
+	log.Check(log.FatalLevel, "Copying "+src+" to "+dst+": "+string(out), err)
+}
+
+func (dirDriver) SubvolumeDestroy(path string) {
+	log.Check(log.DebugLevel, "Removing path "+path, os.RemoveAll(path))
+}
+
+func (dirDriver) Send(src, dst, delta string) error {
+	out, err := exec.Command("tar", "-czf", config.Agent.LxcPrefix+"tmpdir/"+delta, "-C", dst, ".").CombinedOutput()
+	if err != nil {
+		log.Check(log.WarnLevel, "Archiving "+dst+": "+string(out), err)
+		return err
+	}
+	return nil
+}
+
+func (dirDriver) Receive(src, dst, delta string, parent bool) {
+	log.Check(log.FatalLevel, "Creating directory "+dst, os.MkdirAll(dst, 0755))
+	out, err := exec.Command("tar", "-xzf", config.Agent.LxcPrefix+"tmpdir/"+delta, "-C", dst).CombinedOutput()
+	log.Check(log.FatalLevel, "Extracting delta "+delta+": "+string(out), err)
+}
+
+// SetReadOnly is a no-op: plain directories have no readonly property, so
+// the dir driver relies on the caller not writing to template volumes.
+func (dirDriver) SetReadOnly(subvol string, flag bool) {}
+
+// Quota sets nothing and always reports "0" (unlimited); xfs project quotas
+// configured for config.Agent.LxcPrefix out of band are neither set nor read.
+func (dirDriver) Quota(path string, size ...string) string {
+	return "0"
+}
+
+func (dirDriver) DiskQuota(path string, size ...string) string {
+	return "0"
+}
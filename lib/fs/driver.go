@@ -0,0 +1,44 @@
+package fs
+
+import "github.com/subutai-io/agent/config"
+
+// StorageDriver is the common contract the container package and
+// template-handling code use to manage Subutai's on-disk storage, so the
+// host filesystem backing them can be swapped without touching callers.
+type StorageDriver interface {
+	// SubvolumeCreate creates an empty volume at dst.
+	SubvolumeCreate(dst string)
+	// SubvolumeClone creates a writable copy of src at dst.
+	SubvolumeClone(src, dst string)
+	// SubvolumeDestroy removes the volume at path and any nested volumes.
+	SubvolumeDestroy(path string)
+	// Send writes a delta between src and dst (or a full image of dst,
+	// when src == dst) to the file at delta.
+	Send(src, dst, delta string) error
+	// Receive creates dst from a delta previously written by Send,
+	// based on src when parent is true.
+	Receive(src, dst, delta string, parent bool)
+	// SetReadOnly marks subvol read-only or writable.
+	SetReadOnly(subvol string, flag bool)
+	// Quota returns the volume's quota, setting it to size first if given.
+	Quota(path string, size ...string) string
+	// DiskQuota returns the aggregate quota across a container's
+	// subvolumes, setting it to size first if given.
+	DiskQuota(path string, size ...string) string
+}
+
+// drivers maps config.Agent.StorageDriver values to their implementation.
+var drivers = map[string]StorageDriver{
+	"btrfs": btrfsDriver{},
+	"zfs":   zfsDriver{},
+	"dir":   dirDriver{},
+}
+
+// Selected returns the StorageDriver config.Agent.StorageDriver names,
+// defaulting to the btrfs driver this package has always used.
+func Selected() StorageDriver {
+	if d, ok := drivers[config.Agent.StorageDriver]; ok {
+		return d
+	}
+	return drivers["btrfs"]
+}
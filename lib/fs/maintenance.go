@@ -0,0 +1,123 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/log"
+)
+
+// Maintenance reconciles btrfs qgroups under config.Agent.LxcPrefix against
+// the live subvolume list and destroys any qgroup whose subvolume is gone.
+// Leftover qgroups accumulate when SubvolumeDestroy fails partway (e.g. a
+// nested subvolume is busy) or an older agent deleted a subvolume without
+// calling qgroupDestroy, and eventually break "btrfs qgroup limit". It also
+// makes sure every container still has its parent qgroup (1/<id>) and its
+// opt/var/home/rootfs children assigned to it, recreating whichever are
+// missing — the same bookkeeping DiskQuota does on first use, made
+// idempotent so it can run as a periodic repair pass.
+func Maintenance() {
+	subvolumes := subvolumeIDs()
+	valid := validQgroupIDs(subvolumes)
+	for _, qgroup := range qgroupIDs() {
+		if !valid[qgroup] {
+			out, err := exec.Command("btrfs", "qgroup", "destroy", qgroup, config.Agent.LxcPrefix).CombinedOutput()
+			log.Check(log.WarnLevel, "Destroying orphaned qgroup "+qgroup+": "+string(out), err)
+		}
+	}
+
+	for container := range containerSubvolumes(subvolumes) {
+		reconcileContainerQgroups(container)
+	}
+}
+
+// validQgroupIDs returns every qgroup ID Maintenance should treat as still
+// in use: every "0/<id>" subvolume in subvolumes, plus "1/<id>" for each
+// one that's a top-level container, since reconcileContainerQgroups
+// deliberately creates that container's parent qgroup under the same
+// numeric id, just at level 1 instead of level 0.
+func validQgroupIDs(subvolumes map[string]string) map[string]bool {
+	valid := map[string]bool{}
+	for qgroup, path := range subvolumes {
+		valid[qgroup] = true
+		if !strings.Contains(path, "/") {
+			valid["1/"+strings.TrimPrefix(qgroup, "0/")] = true
+		}
+	}
+	return valid
+}
+
+// subvolumeIDs returns every live btrfs subvolume ID under LxcPrefix,
+// keyed by its "0/<id>" qgroup name, mapped to its path.
+func subvolumeIDs() map[string]string {
+	out, err := exec.Command("btrfs", "subvolume", "list", config.Agent.LxcPrefix).Output()
+	log.Check(log.WarnLevel, "Listing BTRFS subvolumes", err)
+
+	ids := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.Fields(scanner.Text())
+		if len(line) > 8 {
+			ids["0/"+line[1]] = line[8]
+		}
+	}
+	return ids
+}
+
+// qgroupIDs returns every qgroup ID currently reported for LxcPrefix.
+func qgroupIDs() []string {
+	out, err := exec.Command("btrfs", "qgroup", "show", "-r", config.Agent.LxcPrefix).Output()
+	log.Check(log.WarnLevel, "Listing BTRFS qgroups", err)
+
+	var ids []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.Fields(scanner.Text())
+		if len(line) > 0 && strings.Contains(line[0], "/") {
+			ids = append(ids, line[0])
+		}
+	}
+	return ids
+}
+
+// containerSubvolumes returns the set of top-level container names found
+// among subvolumes (those whose path has no "/", i.e. isn't one of their
+// own opt/var/home/rootfs children).
+func containerSubvolumes(subvolumes map[string]string) map[string]bool {
+	containers := map[string]bool{}
+	for _, path := range subvolumes {
+		if !strings.Contains(path, "/") {
+			containers[path] = true
+		}
+	}
+	return containers
+}
+
+// reconcileContainerQgroups makes sure container's parent qgroup (1/<id>)
+// exists and that its opt/var/home/rootfs child subvolumes are assigned to
+// it, recreating whichever is missing.
+func reconcileContainerQgroups(container string) {
+	parent := id(container)
+	if parent == "" {
+		return
+	}
+
+	out, err := exec.Command("btrfs", "qgroup", "show", "-r", config.Agent.LxcPrefix).Output()
+	log.Check(log.WarnLevel, "Listing BTRFS qgroups", err)
+	if !strings.Contains(string(out), "1/"+parent) {
+		log.Check(log.WarnLevel, "Recreating parent qgroup for "+container,
+			exec.Command("btrfs", "qgroup", "create", "1/"+parent, config.Agent.LxcPrefix+container).Run())
+	}
+
+	for _, child := range []string{"opt", "var", "home", "rootfs"} {
+		childID := id(container + "/" + child)
+		if childID == "" {
+			continue
+		}
+		log.Check(log.DebugLevel, "Assigning "+child+" qgroup for "+container,
+			exec.Command("btrfs", "qgroup", "assign", "0/"+childID, "1/"+parent, config.Agent.LxcPrefix+container).Run())
+	}
+}
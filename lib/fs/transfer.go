@@ -0,0 +1,253 @@
+package fs
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/log"
+)
+
+// SendStream writes a btrfs send of dst directly to w, incremental against
+// src when src != dst, without buffering through a tmpdir/ delta file the
+// way Send does.
+func SendStream(src, dst string, w io.Writer) error {
+	tmpDir, err := ioutil.TempDir(config.Agent.LxcPrefix+"tmpdir/", "export")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	part := strings.Split(dst, "/")
+	if len(part) == 0 {
+		return nil
+	}
+	tmpVolume := tmpDir + "/" + part[len(part)-1]
+
+	SubvolumeClone(dst, tmpVolume)
+	defer SubvolumeDestroy(tmpVolume)
+	SetVolReadOnly(tmpVolume, true)
+
+	args := []string{"send", tmpVolume}
+	if src != dst {
+		args = []string{"send", "-p", src, tmpVolume}
+	}
+	cmd := exec.Command("btrfs", args...)
+	cmd.Stdout = w
+	return cmd.Run()
+}
+
+// ReceiveStream creates dst from a btrfs send stream read from r, depending
+// on src when parent is true.
+func ReceiveStream(src, dst string, r io.Reader, parent bool) error {
+	args := []string{"receive", dst}
+	if parent {
+		args = []string{"receive", "-p", src, dst}
+	}
+	cmd := exec.Command("btrfs", args...)
+	cmd.Stdin = r
+	out, err := cmd.CombinedOutput()
+	log.Check(log.DebugLevel, "Receiving stream into "+dst+": "+string(out), err)
+	return err
+}
+
+// maxPushRetries bounds how many times Push retries a single snapshot send
+// after a transient failure (a dropped connection, a peer restart mid-
+// stream) before giving up and returning that failure to its caller.
+const maxPushRetries = 3
+
+// pushRetryBackoff is the delay between retries; constant rather than
+// exponential since Push's failures are almost always "the peer wasn't
+// listening yet", not the sustained outages ingress.Run backs off for.
+const pushRetryBackoff = 2 * time.Second
+
+// Push streams a btrfs send of src directly to a peer agent's receive
+// endpoint over HTTP (see TransferHandler), instead of writing a delta to
+// tmpdir/ and uploading it as a separate step. parentSnapshot, if
+// non-empty, is sent as a header so the peer can request the matching
+// incremental stream.
+//
+// btrfs send streams can't be resumed mid-stream — there's no seek point
+// inside one — so "resumable" here means at snapshot granularity: Push
+// returns the snapshot the peer's response acknowledges having durably
+// received (X-Subutai-Received-Parent), and a caller pushing a chain of
+// incremental snapshots should pass that back in as the next call's
+// parentSnapshot, so a failure partway through the chain doesn't force
+// restarting it from the beginning. Each attempt at the current snapshot
+// is itself retried up to maxPushRetries times before Push gives up.
+func Push(ctx context.Context, remoteURL, src, parentSnapshot string) (string, error) {
+	var lastErr error
+	for attempt := 0; attempt <= maxPushRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(pushRetryBackoff):
+			}
+		}
+
+		received, err := pushOnce(ctx, remoteURL, src, parentSnapshot)
+		if err == nil {
+			return received, nil
+		}
+		log.Warn("Push attempt " + strconv.Itoa(attempt+1) + " of " + strconv.Itoa(maxPushRetries+1) + " for " + src + " failed: " + err.Error())
+		lastErr = err
+	}
+	return "", lastErr
+}
+
+// pushOnce makes a single send attempt, with no retry of its own.
+func pushOnce(ctx context.Context, remoteURL, src, parentSnapshot string) (string, error) {
+	// SendStream sends a full stream when its src equals dst.
+	base := parentSnapshot
+	if base == "" {
+		base = src
+	}
+
+	pr, pw := io.Pipe()
+	sendErr := make(chan error, 1)
+	go func() {
+		sendErr <- SendStream(base, src, pw)
+		pw.Close()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, remoteURL, pr)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Subutai-Parent", parentSnapshot)
+	if config.Agent.TransferToken != "" {
+		req.Header.Set("Authorization", "Bearer "+config.Agent.TransferToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.New("push to " + remoteURL + ": " + resp.Status)
+	}
+
+	if err := <-sendErr; err != nil {
+		return "", err
+	}
+	return resp.Header.Get("X-Subutai-Received-Parent"), nil
+}
+
+// Pull fetches a btrfs send stream from a peer agent's send endpoint and
+// receives it into dst, depending on parentSnapshot when set.
+func Pull(ctx context.Context, remoteURL, dst, parentSnapshot string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, remoteURL, nil)
+	if err != nil {
+		return err
+	}
+	if parentSnapshot != "" {
+		req.Header.Set("X-Subutai-Parent", parentSnapshot)
+	}
+	if config.Agent.TransferToken != "" {
+		req.Header.Set("Authorization", "Bearer "+config.Agent.TransferToken)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("pull from " + remoteURL + ": " + resp.Status)
+	}
+	return ReceiveStream(parentSnapshot, dst, resp.Body, parentSnapshot != "")
+}
+
+// TransferHandler serves the receiving side of Push and the sending side
+// of Pull, so two subutaid instances can exchange btrfs snapshots directly
+// without either going through a shared filesystem. The subvolume path is
+// taken from the request URL ("/transfer/<path>"), resolved and confined to
+// config.Agent.LxcPrefix by resolveTransferPath before it ever reaches
+// btrfs; an X-Subutai-Parent request header names the parent snapshot to
+// receive or send incrementally against, the same header Push/Pull set on
+// their requests. Every request must carry an Authorization: Bearer header
+// matching config.Agent.TransferToken - if that token is unset the
+// endpoint refuses all requests rather than serving unauthenticated.
+func TransferHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/transfer/", func(w http.ResponseWriter, r *http.Request) {
+		if !authorizedTransfer(r) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		rel := strings.TrimPrefix(r.URL.Path, "/transfer/")
+		if rel == "" {
+			http.Error(w, "missing subvolume path", http.StatusBadRequest)
+			return
+		}
+		path, err := resolveTransferPath(rel)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		parent := r.Header.Get("X-Subutai-Parent")
+
+		switch r.Method {
+		case http.MethodPost:
+			if err := ReceiveStream(parent, path, r.Body, parent != ""); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("X-Subutai-Received-Parent", path)
+			w.WriteHeader(http.StatusOK)
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/octet-stream")
+			base := parent
+			if base == "" {
+				base = path
+			}
+			if err := SendStream(base, path, w); err != nil {
+				log.Warn("Serving transfer of " + path + " failed: " + err.Error())
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+	return mux
+}
+
+// authorizedTransfer reports whether r carries the bearer token configured
+// in config.Agent.TransferToken. An unset token fails closed - with no
+// token configured, every request is refused rather than the endpoint
+// being served wide open.
+func authorizedTransfer(r *http.Request) bool {
+	if config.Agent.TransferToken == "" {
+		return false
+	}
+	got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(got), []byte(config.Agent.TransferToken)) == 1
+}
+
+// resolveTransferPath turns the URL-supplied, untrusted rel path into an
+// absolute subvolume path confined to config.Agent.LxcPrefix. Any ".."
+// segment is resolved against a virtual root before the prefix is joined,
+// so it cannot climb out of LxcPrefix and let a caller read or write
+// arbitrary paths on the host via btrfs send/receive.
+func resolveTransferPath(rel string) (string, error) {
+	clean := filepath.Clean("/" + rel)
+	prefix := filepath.Clean(config.Agent.LxcPrefix)
+	path := filepath.Join(prefix, clean)
+	if path != prefix && !strings.HasPrefix(path, prefix+"/") {
+		return "", errors.New("subvolume path escapes " + config.Agent.LxcPrefix)
+	}
+	return path, nil
+}
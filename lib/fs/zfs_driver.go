@@ -0,0 +1,99 @@
+package fs
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"strings"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/log"
+)
+
+// zfsDriver implements StorageDriver over ZFS datasets: a Subutai
+// "subvolume" is a dataset, SubvolumeClone snapshots and clones it, and
+// Send/Receive shell out to zfs send/recv.
+type zfsDriver struct{}
+
+// zfsDataset maps an LxcPrefix-relative path to its dataset name, assuming
+// config.Agent.ZfsPool is imported and mounted at config.Agent.LxcPrefix.
+func zfsDataset(path string) string {
+	rel := strings.TrimPrefix(path, config.Agent.LxcPrefix)
+	rel = strings.Trim(rel, "/")
+	if rel == "" {
+		return config.Agent.ZfsPool
+	}
+	return config.Agent.ZfsPool + "/" + rel
+}
+
+func (zfsDriver) SubvolumeCreate(dst string) {
+	out, err := exec.Command("zfs", "create", "-p", zfsDataset(dst)).CombinedOutput()
+	log.Check(log.FatalLevel, "Creating dataset "+dst+": "+string(out), err)
+}
+
+func (zfsDriver) SubvolumeClone(src, dst string) {
+	snapshot := zfsDataset(src) + "@clone"
+	out, err := exec.Command("zfs", "snapshot", snapshot).CombinedOutput()
+	log.Check(log.FatalLevel, "Snapshotting "+src+": "+string(out), err)
+	out, err = exec.Command("zfs", "clone", snapshot, zfsDataset(dst)).CombinedOutput()
+	log.Check(log.FatalLevel, "Cloning "+src+" to "+dst+": "+string(out), err)
+}
+
+func (zfsDriver) SubvolumeDestroy(path string) {
+	out, err := exec.Command("zfs", "destroy", "-r", zfsDataset(path)).CombinedOutput()
+	log.Check(log.DebugLevel, "Destroying dataset "+path+": "+string(out), err)
+}
+
+func (zfsDriver) Send(src, dst, delta string) error {
+	snapshot := zfsDataset(dst) + "@send"
+	if out, err := exec.Command("zfs", "snapshot", snapshot).CombinedOutput(); err != nil {
+		log.Check(log.WarnLevel, "Snapshotting "+dst+": "+string(out), err)
+		return err
+	}
+
+	args := []string{"send", snapshot}
+	if src != dst {
+		args = []string{"send", "-i", zfsDataset(src) + "@send", snapshot}
+	}
+	out, err := exec.Command("zfs", args...).Output()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(config.Agent.LxcPrefix+"tmpdir/"+delta, out, 0644)
+}
+
+func (zfsDriver) Receive(src, dst, delta string, parent bool) {
+	data, err := ioutil.ReadFile(config.Agent.LxcPrefix + "tmpdir/" + delta)
+	if log.Check(log.FatalLevel, "Reading delta "+delta, err) {
+		return
+	}
+	receive := exec.Command("zfs", "receive", zfsDataset(dst))
+	receive.Stdin = bytes.NewReader(data)
+	out, err := receive.CombinedOutput()
+	log.Check(log.FatalLevel, "Receiving delta "+delta+": "+string(out), err)
+}
+
+func (zfsDriver) SetReadOnly(subvol string, flag bool) {
+	value := "off"
+	if flag {
+		value = "on"
+	}
+	out, err := exec.Command("zfs", "set", "readonly="+value, zfsDataset(subvol)).CombinedOutput()
+	log.Check(log.FatalLevel, "Setting readonly="+value+": "+string(out), err)
+}
+
+func (zfsDriver) Quota(path string, size ...string) string {
+	if len(size) > 0 && len(size[0]) > 0 {
+		out, err := exec.Command("zfs", "set", "refquota="+size[0]+"G", zfsDataset(path)).CombinedOutput()
+		if err != nil {
+			return err.Error() + string(out)
+		}
+	}
+	out, err := exec.Command("zfs", "get", "-Hp", "-o", "value", "refquota", zfsDataset(path)).Output()
+	log.Check(log.DebugLevel, "Getting refquota for "+path, err)
+	return strings.TrimSpace(string(out))
+}
+
+func (d zfsDriver) DiskQuota(path string, size ...string) string {
+	return d.Quota(path, size...)
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/subutai-io/agent/cli"
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/ingress"
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/lib/fs"
+	"github.com/subutai-io/agent/log"
+)
+
+// collectDisk refreshes containerDisk from each container's btrfs qgroup
+// quota (the same raw byte count `subutai quota <name>` reports), the way
+// collect already does for CPU/RAM via lib/container.
+func collectDisk() {
+	for _, name := range container.Containers() {
+		raw := fs.Selected().DiskQuota(name)
+		if d := config.Agent.StorageDriver; d != "zfs" && d != "dir" {
+			// btrfs's DiskQuota output is human-readable; re-read it in bytes.
+			raw = fs.Stat(name, "quota", true)
+		}
+		quotaBytes, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			continue
+		}
+		containerDisk.WithLabelValues(name).Set(quotaBytes / (1 << 30))
+	}
+}
+
+// proxySeenMu/proxySeen track the last cumulative count reported by
+// ingress.RequestCounts per hostname, so collectProxy can turn its running
+// totals into the Add() deltas a prometheus.CounterVec requires.
+var (
+	proxySeenMu sync.Mutex
+	proxySeen   = map[string]int64{}
+)
+
+// collectProxy exports the per-hostname request counts the ingress tunnel
+// has forwarded. It only covers traffic that went through the ingress
+// broker session - nginx also proxies MapPort routes directly without
+// touching the ingress package, and this process has no visibility into
+// that traffic without parsing nginx's own access logs.
+func collectProxy() {
+	proxySeenMu.Lock()
+	defer proxySeenMu.Unlock()
+
+	for domain, total := range ingress.RequestCounts() {
+		if delta := total - proxySeen[domain]; delta > 0 {
+			proxyRequestsTotal.WithLabelValues(domain).Add(float64(delta))
+		}
+		proxySeen[domain] = total
+	}
+}
+
+// collectP2P refreshes p2pPeers from the connected-peer count per swarm
+// hash. cli.P2PPeerCounts is the same assumed cli API surface the rest of
+// this package already delegates to for container quotas; the P2P daemon
+// itself isn't part of this tree.
+func collectP2P() {
+	counts, err := cli.P2PPeerCounts()
+	if log.Check(log.DebugLevel, "Listing P2P swarm peers", err) {
+		return
+	}
+	for hash, peers := range counts {
+		p2pPeers.WithLabelValues(hash).Set(float64(peers))
+	}
+}
+
+// collectTunnels refreshes tunnelUp from the reachability of every
+// registered SSH tunnel.
+func collectTunnels() {
+	status, err := cli.TunnelStatus()
+	if log.Check(log.DebugLevel, "Checking SSH tunnel status", err) {
+		return
+	}
+	for name, up := range status {
+		value := 0.0
+		if up {
+			value = 1
+		}
+		tunnelUp.WithLabelValues(name).Set(value)
+	}
+}
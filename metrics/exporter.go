@@ -0,0 +1,92 @@
+// Package metrics exposes Subutai Resource Host telemetry to Prometheus
+// scrapers and, optionally, pushes the same series to an OTLP collector so
+// operators running many RHs can centralize monitoring without InfluxDB.
+package metrics
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/subutai-io/agent/config"
+	"github.com/subutai-io/agent/lib/container"
+	"github.com/subutai-io/agent/log"
+)
+
+var (
+	containerCPU = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "subutai_container_cpu_percent",
+		Help: "CPU quota in percent for a Subutai container.",
+	}, []string{"container"})
+
+	containerRAM = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "subutai_container_ram_mb",
+		Help: "RAM quota in MiB for a Subutai container.",
+	}, []string{"container"})
+
+	containerDisk = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "subutai_container_disk_gb",
+		Help: "Disk quota in GiB for a Subutai container.",
+	}, []string{"container"})
+
+	proxyRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "subutai_proxy_requests_total",
+		Help: "Reverse-proxy requests served per domain.",
+	}, []string{"domain"})
+
+	p2pPeers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "subutai_p2p_swarm_peers",
+		Help: "Connected peer count per P2P swarm hash.",
+	}, []string{"hash"})
+
+	tunnelUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "subutai_ssh_tunnel_up",
+		Help: "1 if the SSH tunnel is reachable, 0 otherwise.",
+	}, []string{"tunnel"})
+)
+
+func init() {
+	prometheus.MustRegister(containerCPU, containerRAM, containerDisk, proxyRequestsTotal, p2pPeers, tunnelUp)
+}
+
+// collect refreshes every gauge from the current container/network state.
+// It runs on every scrape and re-reads each container's quotas through the
+// container and fs packages; nothing is cached between scrapes. An empty
+// size makes QuotaCPU/QuotaRAM read the current value without setting one.
+func collect() {
+	for _, name := range container.Containers() {
+		containerCPU.WithLabelValues(name).Set(float64(container.QuotaCPU(name, "")))
+		containerRAM.WithLabelValues(name).Set(float64(container.QuotaRAM(name, "")))
+	}
+	collectDisk()
+	collectProxy()
+	collectP2P()
+	collectTunnels()
+}
+
+// Serve starts the HTTP server exposing the Prometheus /metrics endpoint on
+// bind (e.g. "0.0.0.0:9911") and blocks until ctx is cancelled or the server
+// fails. If config.Agent.OTLPCollector is set, metrics are additionally
+// pushed there every pushInterval.
+func Serve(ctx context.Context, bind string) error {
+	if len(config.Agent.OTLPCollector) > 0 {
+		go pushOTLP(ctx, config.Agent.OTLPCollector)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		collect()
+		promhttp.Handler().ServeHTTP(w, r)
+	})
+
+	server := &http.Server{Addr: bind, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		log.Check(log.DebugLevel, "Shutting down metrics server", server.Close())
+	}()
+
+	log.Info("Serving Prometheus metrics on " + bind)
+	return server.ListenAndServe()
+}
@@ -0,0 +1,95 @@
+package pipeline
+
+import "errors"
+
+// dag tracks the pending dependency count and dependents for each step so
+// Run can release steps to the worker pool as soon as their last
+// dependency finishes, instead of waiting on a full-manifest barrier.
+type dag struct {
+	steps      map[string]Step
+	remaining  map[string]int
+	dependents map[string][]string
+}
+
+// buildDAG indexes steps by ID and validates that every depends_on entry
+// refers to a step that actually exists in the manifest.
+func buildDAG(steps []Step) (*dag, error) {
+	d := &dag{
+		steps:      make(map[string]Step, len(steps)),
+		remaining:  make(map[string]int, len(steps)),
+		dependents: make(map[string][]string, len(steps)),
+	}
+	for _, s := range steps {
+		if _, exists := d.steps[s.ID]; exists {
+			return nil, errors.New("duplicate step id: " + s.ID)
+		}
+		d.steps[s.ID] = s
+		d.remaining[s.ID] = len(s.DependsOn)
+	}
+	for _, s := range steps {
+		for _, dep := range s.DependsOn {
+			if _, ok := d.steps[dep]; !ok {
+				return nil, errors.New("step " + s.ID + " depends on unknown step " + dep)
+			}
+			d.dependents[dep] = append(d.dependents[dep], s.ID)
+		}
+	}
+	if d.hasCycle() {
+		return nil, errors.New("pipeline manifest contains a dependency cycle")
+	}
+	return d, nil
+}
+
+// ready returns the IDs of every step with no unresolved dependency.
+func (d *dag) ready() []string {
+	var ids []string
+	for id, left := range d.remaining {
+		if left == 0 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// done marks id complete and returns the dependents that became ready.
+func (d *dag) done(id string) []string {
+	delete(d.remaining, id)
+	var freed []string
+	for _, dep := range d.dependents[id] {
+		if _, still := d.remaining[dep]; !still {
+			continue
+		}
+		d.remaining[dep]--
+		if d.remaining[dep] == 0 {
+			freed = append(freed, dep)
+		}
+	}
+	return freed
+}
+
+func (d *dag) hasCycle() bool {
+	visited := make(map[string]int) // 0=unvisited 1=visiting 2=done
+	var visit func(id string) bool
+	visit = func(id string) bool {
+		switch visited[id] {
+		case 1:
+			return true
+		case 2:
+			return false
+		}
+		visited[id] = 1
+		for _, dep := range d.dependents[id] {
+			if visit(dep) {
+				return true
+			}
+		}
+		visited[id] = 2
+		return false
+	}
+	for id := range d.steps {
+		if visit(id) {
+			return true
+		}
+	}
+	return false
+}
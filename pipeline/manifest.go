@@ -0,0 +1,39 @@
+// Package pipeline implements `subutai apply -f pipeline.yaml`: a
+// declarative, dependency-ordered runner that reconciles a Resource Host
+// toward the state described by a YAML manifest of containers, quotas,
+// port maps, proxy entries, vxlan tunnels and P2P swarms.
+package pipeline
+
+import (
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Step is one unit of reconciliation. Kind selects which existing RPC
+// method the step maps onto (clone, quota, map, proxy, vxlan, p2p); Params
+// carries its positional/flag arguments the same way the CLI does.
+type Step struct {
+	ID        string            `yaml:"id"`
+	Kind      string            `yaml:"kind"`
+	Params    map[string]string `yaml:"params"`
+	DependsOn []string          `yaml:"depends_on"`
+}
+
+// Manifest is the top-level pipeline document.
+type Manifest struct {
+	Steps []Step `yaml:"steps"`
+}
+
+// Load parses a pipeline manifest from path.
+func Load(path string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"sync"
+
+	"github.com/subutai-io/agent/log"
+)
+
+// Executor performs one step against the Resource Host, returning an error
+// if reconciliation failed. Run calls it once per step, never twice, and
+// never for a step whose dependencies didn't all succeed.
+type Executor func(step Step) error
+
+// Options controls how a Manifest is executed.
+type Options struct {
+	// Workers bounds how many independent steps run at once. Defaults to 4.
+	Workers int
+	// DryRun logs what would run without calling Executor.
+	DryRun bool
+	// KeepOnFailure skips rollback of already-applied steps when a later
+	// step fails.
+	KeepOnFailure bool
+	// Rollback undoes a previously applied step. Required unless
+	// KeepOnFailure is set.
+	Rollback Executor
+}
+
+// Run builds a dependency DAG from the manifest and executes independent
+// steps concurrently, bounded by Options.Workers. On the first failure it
+// stops scheduling new steps, waits for in-flight ones to finish, and -
+// unless KeepOnFailure is set - rolls back every step that already
+// succeeded, in reverse completion order.
+func Run(m *Manifest, exec Executor, opts Options) error {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+
+	d, err := buildDAG(m.Steps)
+	if err != nil {
+		return err
+	}
+
+	var (
+		mu        sync.Mutex
+		firstErr  error
+		completed []string
+	)
+
+	// ready is fed steps as they become runnable - initially the DAG's
+	// roots, then whatever a worker frees on completion - and closed once
+	// pending reaches zero, so workers can range over it instead of a
+	// recursive scheduler fighting its own worker-count semaphore for a
+	// slot it hasn't released yet.
+	ready := make(chan string, len(d.steps))
+	initial := d.ready()
+	pending := len(initial)
+	for _, id := range initial {
+		ready <- id
+	}
+	if pending == 0 {
+		close(ready)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range ready {
+				step := d.steps[id]
+
+				mu.Lock()
+				failed := firstErr != nil
+				mu.Unlock()
+
+				var freed []string
+				if !failed {
+					log.Info("[" + step.ID + "] applying " + step.Kind)
+					var err error
+					if !opts.DryRun {
+						err = exec(step)
+					}
+
+					mu.Lock()
+					if err != nil {
+						log.Error("[" + step.ID + "] failed: " + err.Error())
+						if firstErr == nil {
+							firstErr = err
+						}
+					} else {
+						completed = append(completed, step.ID)
+						freed = d.done(step.ID)
+					}
+					mu.Unlock()
+				}
+
+				mu.Lock()
+				pending += len(freed) - 1
+				done := pending == 0
+				mu.Unlock()
+				for _, f := range freed {
+					ready <- f
+				}
+				if done {
+					close(ready)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil && !opts.KeepOnFailure && opts.Rollback != nil {
+		for i := len(completed) - 1; i >= 0; i-- {
+			step := d.steps[completed[i]]
+			log.Info("[" + step.ID + "] rolling back " + step.Kind)
+			log.Check(log.WarnLevel, "Rolling back "+step.ID, opts.Rollback(step))
+		}
+	}
+
+	return firstErr
+}
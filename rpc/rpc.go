@@ -0,0 +1,199 @@
+// Package rpc defines the local control protocol spoken between the
+// unprivileged `subutai` client and the privileged `subutaid` daemon over
+// a Unix domain socket. It replaces direct, in-process calls into the `cli`
+// package with a small JSON-over-socket RPC so the client no longer needs
+// to run as root.
+package rpc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+
+	"github.com/subutai-io/agent/log"
+
+	"golang.org/x/sys/unix"
+)
+
+// SockPath is the well-known Unix socket the daemon listens on and the
+// client dials.
+const SockPath = "/var/run/subutai.sock"
+
+// Version is the RPC protocol version, bumped whenever the Request/Response
+// schema changes in a backwards-incompatible way.
+const Version = 1
+
+// Request is a single RPC call: a method name and its positional/flag
+// arguments, marshaled as JSON and framed with a newline delimiter.
+type Request struct {
+	Version int               `json:"version"`
+	Method  string            `json:"method"`
+	Args    []string          `json:"args"`
+	Flags   map[string]string `json:"flags,omitempty"`
+}
+
+// Response carries the result of a Request back to the client.
+type Response struct {
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Handler executes one RPC method against the privileged operations and
+// returns the text that would normally have been printed by the CLI.
+type Handler func(req Request) (string, error)
+
+// Server accepts client connections on SockPath and dispatches Requests to
+// registered Handlers after authorizing the calling user via SO_PEERCRED.
+type Server struct {
+	listener net.Listener
+	handlers map[string]Handler
+	// AllowUID returns true if the peer uid is permitted to make RPC calls.
+	// Defaults to allowing everyone; subutaid restricts this per-method.
+	AllowUID func(method string, uid uint32) bool
+}
+
+// NewServer creates a Server listening on SockPath, replacing any stale
+// socket left behind by a previous daemon instance.
+func NewServer() (*Server, error) {
+	os.Remove(SockPath)
+	l, err := net.Listen("unix", SockPath)
+	if err != nil {
+		return nil, err
+	}
+	log.Check(log.DebugLevel, "Setting socket permissions", os.Chmod(SockPath, 0666))
+	return &Server{listener: l, handlers: make(map[string]Handler)}, nil
+}
+
+// Register binds a method name to the Handler that implements it.
+func (s *Server) Register(method string, h Handler) {
+	s.handlers[method] = h
+}
+
+// Serve accepts connections until the listener is closed.
+func (s *Server) Serve() error {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops Serve from accepting further connections, causing it to
+// return, so a caller can shut the daemon down gracefully from a signal
+// handler instead of only ever exiting via a hard kill.
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	uid, err := peerUID(conn)
+	if log.Check(log.WarnLevel, "Resolving peer credentials", err) {
+		return
+	}
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if log.Check(log.DebugLevel, "Reading RPC request", err) {
+		return
+	}
+
+	var req Request
+	resp := Response{}
+	if err := json.Unmarshal(line, &req); err != nil {
+		resp.Error = err.Error()
+	} else if s.AllowUID != nil && !s.AllowUID(req.Method, uid) {
+		resp.Error = "operation not permitted for this user"
+	} else if h, ok := s.handlers[req.Method]; !ok {
+		resp.Error = "unknown method: " + req.Method
+	} else {
+		out, err := h(req)
+		resp.Output = out
+		if err != nil {
+			resp.Error = err.Error()
+		}
+	}
+
+	data, err := json.Marshal(resp)
+	log.Check(log.DebugLevel, "Marshaling RPC response", err)
+	data = append(data, '\n')
+	_, err = conn.Write(data)
+	log.Check(log.DebugLevel, "Writing RPC response", err)
+}
+
+// peerUID resolves the SO_PEERCRED uid of the Unix socket connection.
+func peerUID(conn net.Conn) (uint32, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return 0, errors.New("not a unix socket connection")
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var cred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if credErr != nil {
+		return 0, credErr
+	}
+	return cred.Uid, nil
+}
+
+// Client dials SockPath and issues Requests to the daemon.
+type Client struct {
+	conn net.Conn
+}
+
+// Dial connects to the running subutaid daemon.
+func Dial() (*Client, error) {
+	conn, err := net.Dial("unix", SockPath)
+	if err != nil {
+		return nil, errors.New("subutaid is not running: " + err.Error())
+	}
+	return &Client{conn: conn}, nil
+}
+
+// Call issues one RPC method with positional args and string flags, and
+// returns the daemon's textual output.
+func (c *Client) Call(method string, args []string, flags map[string]string) (string, error) {
+	req := Request{Version: Version, Method: method, Args: args, Flags: flags}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+	data = append(data, '\n')
+	if _, err := c.conn.Write(data); err != nil {
+		return "", err
+	}
+
+	reader := bufio.NewReader(c.conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return "", err
+	}
+
+	var resp Response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return "", err
+	}
+	if resp.Error != "" {
+		return resp.Output, errors.New(resp.Error)
+	}
+	return resp.Output, nil
+}
+
+// Close releases the underlying socket connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}